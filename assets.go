@@ -0,0 +1,94 @@
+package main
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"os"
+	"path"
+)
+
+// the templates, static files and fonts are built in so racergo runs from anywhere, -dev reads them from the checkout
+// instead and a race's overrides directory replaces them one file at a time
+//
+//go:embed raceResults.template error.template static fonts
+var embeddedAssets embed.FS
+
+// overlayFS opens each file from the first layer that has it
+type overlayFS []fs.FS
+
+func (o overlayFS) Open(name string) (fs.File, error) {
+	err := &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	for _, layer := range o {
+		f, layerErr := layer.Open(name)
+		if layerErr == nil {
+			return f, nil
+		}
+		if !errors.Is(layerErr, fs.ErrNotExist) {
+			return nil, layerErr
+		}
+	}
+	return nil, err
+}
+
+// assetFS returns the files for dir (. for the templates, static or fonts), from the overrides first, then the
+// checkout's devDir in -dev mode or the built in copy
+func (c Config) assetFS(dir, devDir string) fs.FS {
+	var layers overlayFS
+	if c.OverrideDir != "" {
+		layers = append(layers, os.DirFS(path.Join(c.OverrideDir, dir)))
+	}
+	if c.Dev {
+		return append(layers, os.DirFS(devDir))
+	}
+	builtIn, err := fs.Sub(embeddedAssets, dir)
+	if err != nil {
+		panic(fmt.Sprintf("Error opening built in %s - %s", dir, err)) // dir is always one of ours
+	}
+	return append(layers, builtIn)
+}
+
+func (c Config) templateFS() fs.FS {
+	return c.assetFS(".", c.TemplateDir)
+}
+
+func (c Config) staticFS() fs.FS {
+	return c.assetFS("static", c.StaticDir)
+}
+
+func (c Config) fontsFS() fs.FS {
+	return c.assetFS("fonts", c.FontsDir)
+}
+
+// parseTemplates parses raceResults.template and error.template from fsys
+func parseTemplates(fsys fs.FS) (*template.Template, *template.Template, error) {
+	results, err := template.New("template").Funcs(raceResultsFuncMap).ParseFS(fsys, "raceResults.template")
+	if err != nil {
+		return nil, nil, fmt.Errorf("Error parsing raceResults.template - %s", err)
+	}
+	errorsTmpl, err := template.ParseFS(fsys, "error.template")
+	if err != nil {
+		return nil, nil, fmt.Errorf("Error parsing error.template - %s", err)
+	}
+	return results, errorsTmpl, nil
+}
+
+// loadTemplates parses the templates once, in -dev mode they're parsed again for every page by currentTemplates
+func loadTemplates() error {
+	results, errorsTmpl, err := parseTemplates(config.templateFS())
+	if err != nil {
+		return err
+	}
+	raceResultsTemplate, errorTemplate = results, errorsTmpl
+	return nil
+}
+
+// currentTemplates returns the parsed templates, reloading them from disk in -dev mode so edits show on refresh
+func currentTemplates() (*template.Template, *template.Template, error) {
+	if config.Dev {
+		return parseTemplates(config.templateFS())
+	}
+	return raceResultsTemplate, errorTemplate, nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAssetOverrides(t *testing.T) {
+	defer func(c Config) {
+		config = c
+	}(config)
+	config.Dev = false
+	config.TemplateDir = t.TempDir() // not used without -dev
+	config.OverrideDir = t.TempDir()
+	if err := os.MkdirAll(filepath.Join(config.OverrideDir, "static"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(config.OverrideDir, "static", "race.css"), []byte("body { color: orange; }"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	static := http.StripPrefix("/static/", http.FileServer(http.FS(config.staticFS())))
+	for path, want := range map[string]string{
+		"/static/race.css":            "orange",    // from the overrides
+		"/static/jquery-3.1.0.min.js": "jQuery v3", // built in
+	} {
+		w := httptest.NewRecorder()
+		static.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), want) {
+			t.Errorf("%s - expected %q, got %d", path, want, w.Code)
+		}
+	}
+	if _, err := fs.Stat(config.fontsFS(), "glyphicons-halflings-regular.woff"); err != nil {
+		t.Errorf("Expected the built in fonts, got %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(config.OverrideDir, "error.template"), []byte("Custom error - {{.Message}}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadTemplates(); err != nil {
+		t.Fatalf("Error loading templates - %v", err)
+	}
+	defer loadTemplates()
+	w := httptest.NewRecorder()
+	showErrorForAdmin(w, "/admin", "Something went wrong")
+	if w.Body.String() != "Custom error - Something went wrong" {
+		t.Errorf("Expected the race's error template, got %q", w.Body.String())
+	}
+}
+
+func TestDevReload(t *testing.T) {
+	defer func(c Config) {
+		config = c
+		loadTemplates()
+	}(config)
+	config.Dev = true
+	config.OverrideDir = ""
+	config.TemplateDir = t.TempDir()
+	for _, name := range []string{"raceResults.template", "error.template"} {
+		contents, err := fs.ReadFile(embeddedAssets, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = os.WriteFile(filepath.Join(config.TemplateDir, name), contents, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	showError := func() string {
+		w := httptest.NewRecorder()
+		showErrorForAdmin(w, "/admin", "Oops")
+		return w.Body.String()
+	}
+	if body := showError(); !strings.Contains(body, "Oops") {
+		t.Errorf("Expected the error page, got %q", body)
+	}
+	if err := os.WriteFile(filepath.Join(config.TemplateDir, "error.template"), []byte("Edited - {{.Message}}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if body := showError(); body != "Edited - Oops" {
+		t.Errorf("Expected the edited template without a restart, got %q", body)
+	}
+}
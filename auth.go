@@ -0,0 +1,327 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Role is what a logged in user is allowed to do, public users don't log in
+type Role int
+
+const (
+	RolePublic Role = iota
+	RoleRegistration
+	RoleTimer
+	RoleAdmin
+)
+
+func (r Role) String() string {
+	switch r {
+	case RoleRegistration:
+		return "registration"
+	case RoleTimer:
+		return "timer"
+	case RoleAdmin:
+		return "admin"
+	}
+	return "public"
+}
+
+// Allows reports whether a user with this role may do something that requires the other role, admins can do everything
+func (r Role) Allows(required Role) bool {
+	return required == RolePublic || r == required || r == RoleAdmin
+}
+
+// used in html templates
+func (r Role) LoggedIn() bool {
+	return r != RolePublic
+}
+
+func (r Role) IsAdmin() bool {
+	return r == RoleAdmin
+}
+
+func (r Role) CanTime() bool {
+	return r.Allows(RoleTimer)
+}
+
+func (r Role) CanRegister() bool {
+	return r.Allows(RoleRegistration)
+}
+
+const sessionCookie = "racergo_session"
+const sessionLifetime = time.Hour * 12
+
+type session struct {
+	role    Role
+	csrf    string // must accompany every change made by this session
+	expires time.Time
+}
+
+type SessionStore struct {
+	sessions map[string]session
+	sync.Mutex
+}
+
+func NewSessionStore() *SessionStore {
+	return &SessionStore{
+		sessions: make(map[string]session),
+	}
+}
+
+// Create starts a new session for the role and returns its id
+func (ss *SessionStore) Create(role Role) (string, error) {
+	id, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+	csrf, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+	ss.Lock()
+	defer ss.Unlock()
+	ss.sessions[id] = session{
+		role:    role,
+		csrf:    csrf,
+		expires: time.Now().Add(sessionLifetime),
+	}
+	return id, nil
+}
+
+// Get looks up a session by id, unknown and expired sessions are public
+func (ss *SessionStore) Get(id string) session {
+	ss.Lock()
+	defer ss.Unlock()
+	s, ok := ss.sessions[id]
+	if !ok {
+		return session{role: RolePublic}
+	}
+	if time.Now().After(s.expires) {
+		delete(ss.sessions, id)
+		return session{role: RolePublic}
+	}
+	return s
+}
+
+func (ss *SessionStore) Delete(id string) {
+	ss.Lock()
+	defer ss.Unlock()
+	delete(ss.sessions, id)
+}
+
+var sessions = NewSessionStore()
+
+func randomToken() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// roleForToken returns the role a shared secret token logs in as
+func roleForToken(token string) (Role, bool) {
+	if token == "" {
+		return RolePublic, false
+	}
+	for _, rt := range []struct {
+		role  Role
+		token string
+	}{
+		{RoleAdmin, config.AdminToken},
+		{RoleTimer, config.TimerToken},
+		{RoleRegistration, config.RegistrationToken},
+	} {
+		if rt.token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(rt.token)) == 1 {
+			return rt.role, true
+		}
+	}
+	return RolePublic, false
+}
+
+type contextKey int
+
+const (
+	sessionKey contextKey = iota
+	uploadKey             // the rest of an upload's multipart form, see uploadReader
+)
+
+// requestSession returns the session that authorize attached to the request, public if none
+func requestSession(r *http.Request) session {
+	if s, ok := r.Context().Value(sessionKey).(session); ok {
+		return s
+	}
+	return session{role: RolePublic}
+}
+
+func requestRole(r *http.Request) Role {
+	return requestSession(r).role
+}
+
+// requestCSRF is the token the templates need to include in forms
+func requestCSRF(r *http.Request) string {
+	return requestSession(r).csrf
+}
+
+func cookieSession(r *http.Request) session {
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return session{role: RolePublic}
+	}
+	return sessions.Get(cookie.Value)
+}
+
+// authorize only lets users with the required role through to the handler, everyone else is sent to log in
+func authorize(required Role, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s := cookieSession(r)
+		if !s.role.Allows(required) {
+			denied(w, r)
+			return
+		}
+		h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), sessionKey, s)))
+	})
+}
+
+// mutation is authorize for handlers that change the race, they only accept POSTs carrying the session's CSRF token
+func mutation(required Role, h http.Handler) http.Handler {
+	checked := authorize(required, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		want := requestCSRF(r)
+		token, r := submittedCSRF(r)
+		if want == "" || subtle.ConstantTimeCompare([]byte(token), []byte(want)) != 1 {
+			http.Error(w, "Invalid or missing CSRF token - reload the page and try again", http.StatusForbidden)
+			return
+		}
+		h.ServeHTTP(w, r)
+	}))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			w.Header().Set("Allow", "POST")
+			http.Error(w, "Method not allowed - changes must be POSTed", http.StatusMethodNotAllowed)
+			return
+		}
+		checked.ServeHTTP(w, r)
+	})
+}
+
+// submittedCSRF finds the token in the header (scanner/API), the first part of a file upload or the form, never the
+// query string where it would end up in logs, history and Referer headers
+func submittedCSRF(r *http.Request) (string, *http.Request) {
+	if token := r.Header.Get("X-CSRF-Token"); token != "" {
+		return token, r
+	}
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/") {
+		return multipartCSRF(r)
+	}
+	return r.PostFormValue("csrf"), r
+}
+
+// multipartCSRF reads the token from an upload's first part so it's checked before the file is, the upload handlers
+// stream the file from the reader it leaves in the request's context
+func multipartCSRF(r *http.Request) (string, *http.Request) {
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return "", r
+	}
+	part, err := reader.NextPart()
+	if err != nil || part.FormName() != "csrf" {
+		return "", r
+	}
+	token, err := io.ReadAll(io.LimitReader(part, 256))
+	if err != nil {
+		return "", r
+	}
+	return string(token), r.WithContext(context.WithValue(r.Context(), uploadKey, reader))
+}
+
+// uploadReader is the rest of an upload's multipart form once mutation has read the CSRF token from the front of it
+func uploadReader(r *http.Request) (*multipart.Reader, error) {
+	if reader, ok := r.Context().Value(uploadKey).(*multipart.Reader); ok {
+		return reader, nil
+	}
+	return r.MultipartReader()
+}
+
+// pageRoles are the templates served from the catch-all handler which need more than public access
+var pageRoles = map[string]Role{
+	"admin":   RoleAdmin,
+	"audit":   RoleAdmin,
+	"bibs":    RoleAdmin,
+	"dayof":   RoleRegistration,
+	"scanner": RoleTimer,
+}
+
+// authorizePage is authorize for handler, where the role needed depends on which template is requested
+func authorizePage(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.SplitN(strings.Trim(r.URL.Path, "/"), "/", 2)[0]
+		authorize(pageRoles[name], h).ServeHTTP(w, r)
+	})
+}
+
+func denied(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "GET" || r.Method == "HEAD" {
+		http.Redirect(w, r, "/login?"+url.Values{"next": {r.URL.RequestURI()}}.Encode(), http.StatusSeeOther)
+		return
+	}
+	http.Error(w, "Forbidden - log in with a role that can do this", http.StatusForbidden)
+}
+
+// safeRedirect only allows redirects within this site after logging in
+func safeRedirect(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return "/"
+	}
+	return next
+}
+
+func loginHandler(w http.ResponseWriter, r *http.Request, race *Race) {
+	if r.Method != "POST" {
+		handler(w, r, race)
+		return
+	}
+	role, ok := roleForToken(r.FormValue("token"))
+	if !ok {
+		race.raceEvent(actorOf(r), "failed login")
+		showErrorForAdmin(w, r.Referer(), "Invalid login token")
+		return
+	}
+	id, err := sessions.Create(role)
+	if err != nil {
+		showErrorForAdmin(w, r.Referer(), "Error creating session - %v", err)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    id,
+		Path:     "/",
+		MaxAge:   int(sessionLifetime / time.Second),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	race.raceEvent(actor(role, r), "login")
+	http.Redirect(w, r, safeRedirect(r.FormValue("next")), http.StatusSeeOther)
+}
+
+func logoutHandler(w http.ResponseWriter, r *http.Request) {
+	if cookie, err := r.Cookie(sessionCookie); err == nil {
+		sessions.Delete(cookie.Value)
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:   sessionCookie,
+		Value:  "",
+		Path:   "/",
+		MaxAge: -1,
+	})
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestRoles(t *testing.T) {
+	tests := []struct {
+		role     Role
+		required Role
+		allowed  bool
+	}{
+		{RolePublic, RolePublic, true},
+		{RolePublic, RoleTimer, false},
+		{RolePublic, RoleAdmin, false},
+		{RoleTimer, RoleTimer, true},
+		{RoleTimer, RoleRegistration, false},
+		{RoleTimer, RoleAdmin, false},
+		{RoleRegistration, RoleRegistration, true},
+		{RoleRegistration, RoleTimer, false},
+		{RoleAdmin, RoleTimer, true},
+		{RoleAdmin, RoleRegistration, true},
+		{RoleAdmin, RoleAdmin, true},
+	}
+	for _, test := range tests {
+		if got := test.role.Allows(test.required); got != test.allowed {
+			t.Errorf("%s allows %s - wanted %t, got %t", test.role, test.required, test.allowed, got)
+		}
+	}
+}
+
+func login(t *testing.T, token string) *http.Cookie {
+	race := NewRace()
+	r, _ := http.NewRequest("POST", "/login", strings.NewReader(url.Values{"token": {token}, "next": {"/admin"}}.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	loginHandler(w, r, race)
+	for _, c := range w.Result().Cookies() {
+		if c.Name == sessionCookie {
+			if w.Header().Get("Location") != "/admin" {
+				t.Errorf("Expected redirect to /admin after login, got %s", w.Header().Get("Location"))
+			}
+			return c
+		}
+	}
+	return nil
+}
+
+func TestAuthorize(t *testing.T) {
+	config.TimerToken = "timersecret"
+	defer func() {
+		config.TimerToken = ""
+	}()
+	if c := login(t, "wrong"); c != nil {
+		t.Errorf("Expected no session for a bad token")
+	}
+	if c := login(t, ""); c != nil {
+		t.Errorf("Expected no session for an empty token")
+	}
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/login?next=%2Fadmin", nil)
+	loginHandler(w, r, NewRace())
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `value="/admin"`) {
+		t.Errorf("Error fetching login page, got %d - %s", w.Code, w.Body.String())
+	}
+	admin := login(t, config.AdminToken)
+	timer := login(t, "timersecret")
+	if admin == nil || timer == nil {
+		t.Fatalf("Expected sessions for valid tokens")
+	}
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(requestRole(r).String()))
+	})
+	tests := []struct {
+		handler http.Handler
+		method  string
+		url     string
+		cookie  *http.Cookie
+		code    int
+		body    string
+	}{
+		{authorize(RolePublic, ok), "GET", "/search", nil, http.StatusOK, "public"},
+		{authorize(RolePublic, ok), "GET", "/search", timer, http.StatusOK, "timer"},
+		{authorize(RoleTimer, ok), "POST", "/linkBib", nil, http.StatusForbidden, ""},
+		{authorize(RoleTimer, ok), "GET", "/linkBib?bib=1", nil, http.StatusSeeOther, ""},
+		{authorize(RoleTimer, ok), "POST", "/linkBib", timer, http.StatusOK, "timer"},
+		{authorize(RoleTimer, ok), "POST", "/linkBib", admin, http.StatusOK, "admin"},
+		{authorize(RoleAdmin, ok), "POST", "/uploadRacers", timer, http.StatusForbidden, ""},
+		{authorize(RoleAdmin, ok), "POST", "/uploadRacers", &http.Cookie{Name: sessionCookie, Value: "bogus"}, http.StatusForbidden, ""},
+		{authorizePage(ok), "GET", "/results", nil, http.StatusOK, "public"},
+		{authorizePage(ok), "GET", "/audit", nil, http.StatusSeeOther, ""},
+		{authorizePage(ok), "GET", "/admin/anything", timer, http.StatusSeeOther, ""},
+		{authorizePage(ok), "GET", "/admin/anything", admin, http.StatusOK, "admin"},
+	}
+	for x, test := range tests {
+		r, _ := http.NewRequest(test.method, test.url, nil)
+		if test.cookie != nil {
+			r.AddCookie(test.cookie)
+		}
+		w := httptest.NewRecorder()
+		test.handler.ServeHTTP(w, r)
+		if w.Code != test.code || (test.body != "" && w.Body.String() != test.body) {
+			t.Errorf("%d - %s %s - expected %d %q, got %d %q", x, test.method, test.url, test.code, test.body, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestSafeRedirect(t *testing.T) {
+	for next, want := range map[string]string{
+		"/admin":             "/admin",
+		"":                   "/",
+		"http://evil.com/":   "/",
+		"//evil.com/":        "/",
+		"/\\evil.com":        "/",
+		"/runner/7?x=y":      "/runner/7?x=y",
+		"javascript:alert()": "/",
+	} {
+		if got := safeRedirect(next); got != want {
+			t.Errorf("safeRedirect(%q) - wanted %q, got %q", next, want, got)
+		}
+	}
+}
+
+func TestMutation(t *testing.T) {
+	admin := login(t, config.AdminToken)
+	if admin == nil {
+		t.Fatalf("Expected a session for a valid token")
+	}
+	csrf := sessions.Get(admin.Value).csrf
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/") {
+			reader, err := uploadReader(r)
+			if err != nil {
+				t.Fatalf("Error getting the upload - %v", err)
+			}
+			if part, err := reader.NextPart(); err != nil || part.FormName() != "entries" {
+				t.Errorf("Expected the file after the token, got %v", err)
+			}
+		}
+		w.Write([]byte("ok"))
+	})
+	upload := func(token string) string {
+		return "--x\r\nContent-Disposition: form-data; name=\"csrf\"\r\n\r\n" + token +
+			"\r\n--x\r\nContent-Disposition: form-data; name=\"entries\"; filename=\"entries.csv\"\r\n\r\nFname\r\n--x--\r\n"
+	}
+	tests := []struct {
+		method      string
+		url         string
+		contentType string
+		body        string
+		header      string
+		cookie      *http.Cookie
+		code        int
+	}{
+		{"GET", "/linkBib?bib=1&scanned=true", "", "", "", admin, http.StatusMethodNotAllowed},
+		{"GET", "/linkBib?bib=1&scanned=true", "", "", "", nil, http.StatusMethodNotAllowed},
+		{"POST", "/linkBib", "application/x-www-form-urlencoded", "bib=1&csrf=" + csrf, "", nil, http.StatusForbidden},
+		{"POST", "/linkBib", "application/x-www-form-urlencoded", "bib=1", "", admin, http.StatusForbidden},
+		{"POST", "/linkBib", "application/x-www-form-urlencoded", "bib=1&csrf=wrong", "", admin, http.StatusForbidden},
+		{"POST", "/linkBib", "application/x-www-form-urlencoded", "bib=1&csrf=" + csrf, "", admin, http.StatusOK},
+		{"POST", "/linkBib", "application/x-www-form-urlencoded", "bib=1", csrf, admin, http.StatusOK},
+		{"POST", "/uploadRacers", "multipart/form-data; boundary=x", upload(csrf), "", admin, http.StatusOK},
+		{"POST", "/uploadRacers", "multipart/form-data; boundary=x", upload("wrong"), "", admin, http.StatusForbidden},
+		{"POST", "/uploadRacers?csrf=" + csrf, "multipart/form-data; boundary=x", "--x--", "", admin, http.StatusForbidden},
+		{"POST", "/uploadRacers", "multipart/form-data; boundary=x", "--x--", "", admin, http.StatusForbidden},
+	}
+	for x, test := range tests {
+		r, _ := http.NewRequest(test.method, test.url, strings.NewReader(test.body))
+		if test.contentType != "" {
+			r.Header.Set("Content-Type", test.contentType)
+		}
+		if test.header != "" {
+			r.Header.Set("X-CSRF-Token", test.header)
+		}
+		if test.cookie != nil {
+			r.AddCookie(test.cookie)
+		}
+		w := httptest.NewRecorder()
+		mutation(RoleTimer, ok).ServeHTTP(w, r)
+		if w.Code != test.code {
+			t.Errorf("%d - %s %s - expected %d, got %d %q", x, test.method, test.url, test.code, w.Code, w.Body.String())
+		}
+		if w.Code == http.StatusMethodNotAllowed && w.Header().Get("Allow") != "POST" {
+			t.Errorf("%d - expected an Allow header on 405", x)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"fmt"
+	"hash/fnv"
+	"io/fs"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// staticMaxAge is how long phones keep /static/ and /fonts/ files before checking them again, the names aren't
+// versioned so it's kept to about a race's length in case the overrides change
+const staticMaxAge = time.Hour
+
+// bootID is part of every page's ETag, the race's version starts over when racergo restarts
+var bootID = strconv.FormatInt(time.Now().UnixNano(), 36)
+
+// pageETag identifies a page rendered from snap, pages differ by role and carry the session's CSRF token so the
+// session is part of it
+func pageETag(snap *RaceSnapshot, r *http.Request) string {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%s\x00%s\x00%s", requestRole(r), requestCSRF(r), r.URL.RequestURI())
+	return fmt.Sprintf("W/\"%s-%d-%x\"", bootID, snap.Version, h.Sum64())
+}
+
+// notModified sets the page's validators and answers 304 if the client already has it, the page isn't rendered then
+func notModified(w http.ResponseWriter, r *http.Request, etag string, modified time.Time) bool {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		return false
+	}
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache") // always check, it's only a 304 if nothing changed
+	w.Header().Add("Vary", "Cookie")
+	if !modified.IsZero() {
+		w.Header().Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	}
+	if match := r.Header.Get("If-None-Match"); match != "" {
+		if !etagMatches(match, etag) {
+			return false
+		}
+	} else {
+		// Last-Modified can't tell one session's page from another's, so it's only trusted for logged out visitors
+		since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+		if err != nil || modified.IsZero() || requestCSRF(r) != "" || modified.Truncate(time.Second).After(since) {
+			return false
+		}
+	}
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// etagMatches compares If-None-Match weakly, which is all a 304 needs
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// staticHandler serves /static/ and /fonts/ with cache headers, the built in files have no modification time so
+// they get an ETag from their contents instead
+func staticHandler(prefix string, fsys fs.FS) http.Handler {
+	var etags sync.Map // file name to ETag, built in files never change while racergo is running
+	files := http.StripPrefix(prefix, http.FileServer(http.FS(fsys)))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, prefix)
+		if info, err := fs.Stat(fsys, name); err == nil && !info.IsDir() {
+			if config.Dev {
+				w.Header().Set("Cache-Control", "no-cache")
+			} else {
+				w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(staticMaxAge.Seconds())))
+			}
+			if info.ModTime().IsZero() {
+				etag, ok := etags.Load(name)
+				if !ok {
+					if data, err := fs.ReadFile(fsys, name); err == nil {
+						sum := sha256.Sum256(data)
+						etag, _ = etags.LoadOrStore(name, fmt.Sprintf("\"%x\"", sum[:8]))
+					}
+				}
+				if etag != nil {
+					w.Header().Set("ETag", etag.(string))
+				}
+			}
+		}
+		files.ServeHTTP(w, r)
+	})
+}
+
+// compressible are the content types worth gzipping, images and fonts other than svg are already compressed
+var compressible = map[string]bool{
+	"text/html":              true,
+	"text/css":               true,
+	"text/csv":               true,
+	"text/plain":             true,
+	"text/javascript":        true,
+	"application/javascript": true,
+	"application/json":       true,
+	"application/csv":        true,
+	"image/svg+xml":          true,
+}
+
+var gzipWriters = sync.Pool{New: func() interface{} {
+	gz, _ := gzip.NewWriterLevel(nil, gzip.BestSpeed) // the hotspot is the bottleneck, not the cpu
+	return gz
+}}
+
+// gzipHandler compresses pages, the CSV download and static text files for clients that accept gzip
+func gzipHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if !acceptsGzip(r) || r.Header.Get("Range") != "" {
+			h.ServeHTTP(w, r)
+			return
+		}
+		gw := &gzipResponseWriter{ResponseWriter: w}
+		defer gw.Close()
+		h.ServeHTTP(gw, r)
+	})
+}
+
+func acceptsGzip(r *http.Request) bool {
+	for _, coding := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(coding), ";")
+		if strings.TrimSpace(name) == "gzip" && strings.ReplaceAll(params, " ", "") != "q=0" {
+			return true
+		}
+	}
+	return false
+}
+
+// gzipResponseWriter decides whether to compress when the status is written, by then the content type is known
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	gz          *gzip.Writer
+	wroteHeader bool
+}
+
+func (gw *gzipResponseWriter) WriteHeader(code int) {
+	if gw.wroteHeader {
+		return
+	}
+	gw.wroteHeader = true
+	header := gw.Header()
+	mediaType, _, _ := mime.ParseMediaType(header.Get("Content-Type"))
+	if code == http.StatusOK && header.Get("Content-Encoding") == "" && compressible[mediaType] {
+		header.Del("Content-Length")
+		header.Set("Content-Encoding", "gzip")
+		if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			header.Set("ETag", "W/"+etag) // the bytes differ from the uncompressed file's
+		}
+		gw.gz = gzipWriters.Get().(*gzip.Writer)
+		gw.gz.Reset(gw.ResponseWriter)
+	}
+	gw.ResponseWriter.WriteHeader(code)
+}
+
+func (gw *gzipResponseWriter) Write(p []byte) (int, error) {
+	if !gw.wroteHeader {
+		if gw.Header().Get("Content-Type") == "" {
+			gw.Header().Set("Content-Type", http.DetectContentType(p))
+		}
+		gw.WriteHeader(http.StatusOK)
+	}
+	if gw.gz != nil {
+		return gw.gz.Write(p)
+	}
+	return gw.ResponseWriter.Write(p)
+}
+
+// Flush keeps the event stream working through the wrapper
+func (gw *gzipResponseWriter) Flush() {
+	if gw.gz != nil {
+		gw.gz.Flush()
+	}
+	if flusher, ok := gw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (gw *gzipResponseWriter) Close() {
+	if gw.gz == nil {
+		return
+	}
+	gw.gz.Close()
+	gw.gz.Reset(nil)
+	gzipWriters.Put(gw.gz)
+	gw.gz = nil
+}
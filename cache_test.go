@@ -0,0 +1,175 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPageETag(t *testing.T) {
+	clock := NewManualClock(time.Now())
+	race := NewRaceWithClock(clock)
+	if err := race.AddEntry(Entry{Bib: "1", Fname: "Matthew", Lname: "Zimmerman", Age: 34, Male: true}); err != nil {
+		t.Fatalf("Error adding entry - %v", err)
+	}
+	startRace(race)
+	page := authorizePage(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler(w, r, race)
+	}))
+	get := func(url string, cookie *http.Cookie, header, value string) *httptest.ResponseRecorder {
+		r, _ := http.NewRequest("GET", url, nil)
+		if cookie != nil {
+			r.AddCookie(cookie)
+		}
+		if header != "" {
+			r.Header.Set(header, value)
+		}
+		w := httptest.NewRecorder()
+		page.ServeHTTP(w, r)
+		return w
+	}
+	first := get("/results", nil, "", "")
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || etag == "" || first.Header().Get("Last-Modified") == "" {
+		t.Fatalf("Expected the results with validators, got %d %q", first.Code, etag)
+	}
+	if w := get("/results", nil, "If-None-Match", etag); w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Errorf("Expected 304 for an unchanged page, got %d", w.Code)
+	}
+	if w := get("/results", nil, "If-Modified-Since", first.Header().Get("Last-Modified")); w.Code != http.StatusNotModified {
+		t.Errorf("Expected 304 for an unchanged page by date, got %d", w.Code)
+	}
+	if w := get("/results?bib=1", nil, "If-None-Match", etag); w.Code != http.StatusOK {
+		t.Errorf("Expected a different page for a different query, got %d", w.Code)
+	}
+	admin := login(t, config.AdminToken)
+	w := get("/admin", admin, "", "")
+	if w.Code != http.StatusOK || w.Header().Get("ETag") == etag {
+		t.Fatalf("Expected the admin page with its own ETag, got %d", w.Code)
+	}
+	if w := get("/admin", admin, "If-Modified-Since", first.Header().Get("Last-Modified")); w.Code != http.StatusOK {
+		t.Errorf("Expected a logged in page not to trust If-Modified-Since, got %d", w.Code)
+	}
+
+	clock.Advance(time.Minute)
+	if err := race.RecordTimeForBib("1"); err != nil {
+		t.Fatalf("Error recording bib - %v", err)
+	}
+	w = get("/results", nil, "If-None-Match", etag)
+	if w.Code != http.StatusOK || w.Header().Get("ETag") == etag {
+		t.Errorf("Expected a new page after a finish, got %d %q", w.Code, w.Header().Get("ETag"))
+	}
+}
+
+func TestGzip(t *testing.T) {
+	body := strings.Repeat("Bib,Fname,Lname\n1,Matthew,Zimmerman\n", 100)
+	h := gzipHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/download":
+			w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		case "/qr.png":
+			w.Header().Set("Content-Type", "image/png")
+		}
+		io.WriteString(w, body)
+	}))
+	tests := []struct {
+		path     string
+		encoding string
+		rangeHdr string
+		gzipped  bool
+	}{
+		{"/download", "gzip, deflate", "", true},
+		{"/results", "gzip", "", true}, // sniffed as text
+		{"/download", "", "", false},
+		{"/download", "gzip;q=0", "", false},
+		{"/download", "gzip", "bytes=0-10", false},
+		{"/qr.png", "gzip", "", false},
+	}
+	for _, test := range tests {
+		r, _ := http.NewRequest("GET", test.path, nil)
+		r.Header.Set("Accept-Encoding", test.encoding)
+		if test.rangeHdr != "" {
+			r.Header.Set("Range", test.rangeHdr)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if gzipped := w.Header().Get("Content-Encoding") == "gzip"; gzipped != test.gzipped {
+			t.Errorf("%s %q - expected gzipped %t", test.path, test.encoding, test.gzipped)
+			continue
+		}
+		got := w.Body.String()
+		if test.gzipped {
+			if w.Body.Len() >= len(body) {
+				t.Errorf("%s - expected compression, got %d bytes from %d", test.path, w.Body.Len(), len(body))
+			}
+			gz, err := gzip.NewReader(w.Body)
+			if err != nil {
+				t.Fatalf("%s - error reading gzip - %v", test.path, err)
+			}
+			data, _ := io.ReadAll(gz)
+			got = string(data)
+		}
+		if got != body {
+			t.Errorf("%s - expected the body back unchanged", test.path)
+		}
+	}
+
+	// the event stream still flushes each event through the wrapper
+	events := gzipHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, "event: now\ndata: 1\n\n")
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	srv := httptest.NewServer(events)
+	defer srv.Close()
+	r, _ := http.NewRequest("GET", srv.URL, nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	resp, err := http.DefaultClient.Do(r)
+	if err != nil {
+		t.Fatalf("Error connecting to events - %v", err)
+	}
+	defer resp.Body.Close()
+	buf := make([]byte, 64)
+	if n, _ := resp.Body.Read(buf); !strings.HasPrefix(string(buf[:n]), "event: now") {
+		t.Errorf("Expected the event uncompressed and flushed, got %q", buf[:n])
+	}
+}
+
+func TestStaticCache(t *testing.T) {
+	defer func(c Config) {
+		config = c
+	}(config)
+	config.Dev = false
+	config.OverrideDir = ""
+	static := gzipHandler(staticHandler("/static/", config.staticFS()))
+	get := func(etag string) *httptest.ResponseRecorder {
+		r, _ := http.NewRequest("GET", "/static/bootstrap.min.css", nil)
+		r.Header.Set("Accept-Encoding", "gzip")
+		if etag != "" {
+			r.Header.Set("If-None-Match", etag)
+		}
+		w := httptest.NewRecorder()
+		static.ServeHTTP(w, r)
+		return w
+	}
+	w := get("")
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || etag == "" || w.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("Expected the gzipped stylesheet with an ETag, got %d %q", w.Code, etag)
+	}
+	if cc := w.Header().Get("Cache-Control"); !strings.Contains(cc, "max-age=") {
+		t.Errorf("Expected the stylesheet to be cached, got %q", cc)
+	}
+	if w := get(etag); w.Code != http.StatusNotModified {
+		t.Errorf("Expected 304 for an unchanged stylesheet, got %d", w.Code)
+	}
+	config.Dev = true
+	if cc := get("").Header().Get("Cache-Control"); cc != "no-cache" {
+		t.Errorf("Expected -dev to always check for changes, got %q", cc)
+	}
+}
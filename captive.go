@@ -0,0 +1,78 @@
+package main
+
+import (
+	"io"
+	"net/http"
+)
+
+// how racergo answers a platform's captive portal check
+const (
+	captiveOnline = "online" // answer like the real internet so the phone stays connected
+	captivePortal = "portal" // send the phone to the results page, which it shows as the wifi sign in page
+	captiveOff    = "off"    // don't treat the check specially, it gets the normal redirect
+)
+
+// captivePlatforms are the platforms whose checks racergo recognizes
+var captivePlatforms = map[string]bool{
+	"android": true,
+	"apple":   true,
+	"windows": true,
+	"firefox": true,
+}
+
+// captiveProbe is a connectivity check URL path and the answer the platform expects when it's online
+type captiveProbe struct {
+	platform string
+	status   int
+	body     string
+}
+
+var captiveProbes = map[string]captiveProbe{
+	"/generate_204":              {"android", http.StatusNoContent, ""},
+	"/gen_204":                   {"android", http.StatusNoContent, ""},
+	"/hotspot-detect.html":       {"apple", http.StatusOK, "<HTML><HEAD><TITLE>Success</TITLE></HEAD><BODY>Success</BODY></HTML>"},
+	"/library/test/success.html": {"apple", http.StatusOK, "<HTML><HEAD><TITLE>Success</TITLE></HEAD><BODY>Success</BODY></HTML>"},
+	"/connecttest.txt":           {"windows", http.StatusOK, "Microsoft Connect Test"},
+	"/ncsi.txt":                  {"windows", http.StatusOK, "Microsoft NCSI"},
+	"/success.txt":               {"firefox", http.StatusOK, "success\n"},
+	"/canonical.html":            {"firefox", http.StatusOK, `<meta http-equiv="refresh" content="0;url=https://support.mozilla.org/kb/captive-portal"/>`},
+}
+
+// captiveMode is how the platform's checks are answered, online unless configured otherwise
+func captiveMode(platform string) string {
+	if mode, ok := config.Captive[platform]; ok {
+		return mode
+	}
+	return captiveOnline
+}
+
+// isCaptiveProbe reports whether racergo answers the request as a connectivity check
+func isCaptiveProbe(r *http.Request) bool {
+	probe, ok := captiveProbes[r.URL.Path]
+	return ok && captiveMode(probe.platform) != captiveOff
+}
+
+// captiveHandler answers the connectivity checks phones make when joining the race wifi, everything else goes to h
+func captiveHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		probe, ok := captiveProbes[r.URL.Path]
+		if !ok {
+			h.ServeHTTP(w, r)
+			return
+		}
+		switch captiveMode(probe.platform) {
+		case captiveOnline:
+			w.Header().Set("Cache-Control", "no-cache, no-store")
+			if probe.body != "" {
+				w.Header().Set("Content-Type", http.DetectContentType([]byte(probe.body)))
+			}
+			w.WriteHeader(probe.status)
+			io.WriteString(w, probe.body)
+		case captivePortal:
+			w.Header().Set("Cache-Control", "no-cache, no-store")
+			http.Redirect(w, r, localURL(r, "/"), http.StatusFound)
+		default:
+			h.ServeHTTP(w, r)
+		}
+	})
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCaptivePortal(t *testing.T) {
+	defer func(captive map[string]string) {
+		config.Captive = captive
+	}(config.Captive)
+	config.Captive = map[string]string{"apple": captivePortal, "windows": captiveOff}
+	h := captiveHandler(http.RedirectHandler("http://raceresults/", 307))
+	for url, want := range map[string]struct {
+		code int
+		body string
+	}{
+		"http://connectivitycheck.gstatic.com/generate_204": {http.StatusNoContent, ""},
+		"http://detectportal.firefox.com/success.txt":       {http.StatusOK, "success\n"},
+		"http://captive.apple.com/hotspot-detect.html":      {http.StatusFound, ""},
+		"http://www.msftconnecttest.com/connecttest.txt":    {307, ""},
+		"http://example.com/somewhere":                      {307, ""},
+	} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+		if w.Code != want.code {
+			t.Errorf("Expected %d for %s, got %d", want.code, url, w.Code)
+		}
+		if want.body != "" && w.Body.String() != want.body {
+			t.Errorf("Expected body %q for %s, got %q", want.body, url, w.Body.String())
+		}
+	}
+	if isCaptiveProbe(httptest.NewRequest("GET", "http://www.msftconnecttest.com/connecttest.txt", nil)) {
+		t.Errorf("Windows checks are turned off and shouldn't be treated as a probe")
+	}
+	if !isCaptiveProbe(httptest.NewRequest("GET", "http://captive.apple.com/hotspot-detect.html", nil)) {
+		t.Errorf("Expected the apple check to be a probe")
+	}
+
+	c := defaultConfig()
+	c.HTTPSAddr = ""
+	c.Captive = map[string]string{"blackberry": captiveOnline, "android": "sometimes"}
+	if err := c.Validate(); err == nil {
+		t.Errorf("Expected errors for an unknown platform and mode")
+	}
+	if err := LoadConfig(&c, []string{"-captive", "android=portal,apple=off"}); err != nil {
+		t.Fatalf("Error loading captive flag - %v", err)
+	}
+	if c.Captive["android"] != captivePortal || c.Captive["apple"] != captiveOff {
+		t.Errorf("Expected the captive flag to set each platform, got %v", c.Captive)
+	}
+}
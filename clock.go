@@ -0,0 +1,165 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock is where the race gets the time, everything the race clock depends on goes through one so the tests can
+// control time and a rehearsal can run faster than it
+type Clock interface {
+	Now() time.Time
+	// AfterFunc calls f once d has passed on this clock
+	AfterFunc(d time.Duration, f func()) Timer
+	// Rate is how many seconds pass on this clock for every real one, for the pages' clocks to keep up with
+	Rate() float64
+}
+
+// Timer is a pending AfterFunc, Stop reports whether it stopped f from being called
+type Timer interface {
+	Stop() bool
+}
+
+// RealClock is the system's clock
+var RealClock Clock = realClock{}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) AfterFunc(d time.Duration, f func()) Timer {
+	return time.AfterFunc(d, f)
+}
+
+func (realClock) Rate() float64 {
+	return 1
+}
+
+// FixedClock is stopped at an instant, its timers never fire
+type FixedClock time.Time
+
+func (c FixedClock) Now() time.Time {
+	return time.Time(c)
+}
+
+func (FixedClock) AfterFunc(d time.Duration, f func()) Timer {
+	return neverTimer{}
+}
+
+func (FixedClock) Rate() float64 {
+	return 0
+}
+
+type neverTimer struct{}
+
+func (neverTimer) Stop() bool {
+	return true
+}
+
+// ManualClock only moves when it's told to, timers that come due as it moves are called before Advance or Set
+// returns, in the order they were due
+type ManualClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*manualTimer
+}
+
+func NewManualClock(now time.Time) *ManualClock {
+	return &ManualClock{now: now}
+}
+
+func (c *ManualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *ManualClock) Rate() float64 {
+	return 0
+}
+
+func (c *ManualClock) AfterFunc(d time.Duration, f func()) Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &manualTimer{clock: c, at: c.now.Add(d), f: f}
+	c.timers = append(c.timers, t)
+	return t
+}
+
+// Advance moves the clock forward by d
+func (c *ManualClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.set(c.now.Add(d))
+}
+
+// Set moves the clock to now, timers only fire going forward
+func (c *ManualClock) Set(now time.Time) {
+	c.mu.Lock()
+	c.set(now)
+}
+
+// set is called with mu locked and unlocks it before calling the timers that are due, they may well use the clock
+func (c *ManualClock) set(now time.Time) {
+	c.now = now
+	var due []*manualTimer
+	pending := c.timers[:0]
+	for _, t := range c.timers {
+		if t.at.After(now) {
+			pending = append(pending, t)
+		} else {
+			due = append(due, t)
+		}
+	}
+	clear(c.timers[len(pending):])
+	c.timers = pending
+	c.mu.Unlock()
+	sort.SliceStable(due, func(i, j int) bool {
+		return due[i].at.Before(due[j].at)
+	})
+	for _, t := range due {
+		t.f()
+	}
+}
+
+type manualTimer struct {
+	clock *ManualClock
+	at    time.Time
+	f     func()
+}
+
+func (t *manualTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	for x, pending := range t.clock.timers {
+		if pending == t {
+			t.clock.timers = append(t.clock.timers[:x], t.clock.timers[x+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// AcceleratedClock runs rate times faster than real time from the instant it was made, for rehearsing a race
+type AcceleratedClock struct {
+	start time.Time // the real time it was made, with its monotonic reading
+	rate  float64
+}
+
+func NewAcceleratedClock(rate float64) *AcceleratedClock {
+	return &AcceleratedClock{start: time.Now(), rate: rate}
+}
+
+func (c *AcceleratedClock) Now() time.Time {
+	return c.start.Add(time.Duration(float64(time.Since(c.start)) * c.rate)).Round(0)
+}
+
+func (c *AcceleratedClock) AfterFunc(d time.Duration, f func()) Timer {
+	return time.AfterFunc(time.Duration(float64(d)/c.rate), f)
+}
+
+func (c *AcceleratedClock) Rate() float64 {
+	return c.rate
+}
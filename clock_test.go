@@ -0,0 +1,95 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFixedClock(t *testing.T) {
+	now := time.Date(2026, 10, 19, 7, 30, 0, 0, time.UTC)
+	clock := FixedClock(now)
+	fired := false
+	timer := clock.AfterFunc(0, func() {
+		fired = true
+	})
+	if !clock.Now().Equal(now) || clock.Rate() != 0 {
+		t.Errorf("Expected the clock stopped at %s, got %s at rate %g", now, clock.Now(), clock.Rate())
+	}
+	if !timer.Stop() || fired {
+		t.Errorf("Expected the fixed clock's timers never to fire")
+	}
+}
+
+func TestManualClock(t *testing.T) {
+	now := time.Date(2026, 10, 19, 7, 30, 0, 0, time.UTC)
+	clock := NewManualClock(now)
+	var fired []string
+	clock.AfterFunc(time.Minute*2, func() {
+		fired = append(fired, "2m")
+	})
+	clock.AfterFunc(time.Minute, func() {
+		fired = append(fired, "1m")
+		clock.AfterFunc(0, func() { // timers can use the clock, this one is due on the next move
+			fired = append(fired, "after 1m")
+		})
+	})
+	stopped := clock.AfterFunc(time.Minute, func() {
+		fired = append(fired, "stopped")
+	})
+	clock.Advance(time.Second * 59)
+	if len(fired) != 0 {
+		t.Errorf("Expected nothing due yet, got %v", fired)
+	}
+	if !stopped.Stop() {
+		t.Errorf("Expected to stop a pending timer")
+	}
+	clock.Advance(time.Second)
+	if !slices.Equal(fired, []string{"1m"}) {
+		t.Errorf("Expected the minute's timer, got %v", fired)
+	}
+	clock.Set(now.Add(time.Hour))
+	if want := []string{"1m", "after 1m", "2m"}; !slices.Equal(fired, want) {
+		t.Errorf("Expected %v, got %v", want, fired)
+	}
+	if stopped.Stop() {
+		t.Errorf("Expected stopping a timer twice to report it was already stopped")
+	}
+	if want := now.Add(time.Hour); !clock.Now().Equal(want) {
+		t.Errorf("Expected %s, got %s", want, clock.Now())
+	}
+}
+
+func TestAcceleratedClock(t *testing.T) {
+	clock := NewAcceleratedClock(1000)
+	start := clock.Now()
+	fired := make(chan time.Time, 1)
+	clock.AfterFunc(time.Minute, func() {
+		fired <- clock.Now()
+	})
+	select {
+	case at := <-fired:
+		if elapsed := at.Sub(start); elapsed < time.Minute {
+			t.Errorf("Expected a minute to pass on the clock, got %s", elapsed)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected a minute at 1000 times to pass in 60ms")
+	}
+}
+
+func TestPageClock(t *testing.T) {
+	now := time.Date(2026, 10, 19, 7, 30, 0, 0, time.Local)
+	race := NewRaceWithClock(FixedClock(now))
+	if err := race.ScheduleStart(now.Add(time.Minute * 90)); err != nil {
+		t.Fatalf("Error scheduling start - %v", err)
+	}
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/", nil)
+	handler(w, r, race)
+	if !strings.Contains(w.Body.String(), "-01:30:00") {
+		t.Errorf("Expected the countdown from the race's clock - %s", w.Body.String())
+	}
+}
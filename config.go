@@ -0,0 +1,384 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/darkhelmet/env"
+)
+
+// Config holds every setting for racergo, loaded from the environment, then the config file, then flags
+type Config struct {
+	HTTPAddr          string            `json:"httpAddr"`          // address to serve http on - default :80, falling back to :8080
+	HTTPSAddr         string            `json:"httpsAddr"`         // address to serve https on, blank to disable - default :443
+	TLSCert           string            `json:"tlsCert"`           // certificate file for https - generated in dataDir if not set
+	TLSKey            string            `json:"tlsKey"`            // key file for https - generated in dataDir if not set
+	RedirectHTTPS     bool              `json:"redirectHTTPS"`     // send http requests to https
+	DNSAddr           string            `json:"dnsAddr"`           // address to answer DNS queries on, e.g. :53, blank to disable
+	DNSCatchAll       bool              `json:"dnsCatchAll"`       // answer every name with racergo's address, not just the hostnames
+	DNSIP             string            `json:"dnsIP"`             // the address DNS answers with - default the LAN address the query came in on
+	MDNS              bool              `json:"mdns"`              // advertise racergo on the LAN with mDNS/DNS-SD - default true
+	Captive           map[string]string `json:"captive"`           // platform (android, apple, windows, firefox) to online, portal or off - default online
+	WebserverHostname string            `json:"hostname"`          // the url to serve on - default localhost:8080
+	Hostnames         []string          `json:"hostnames"`         // other hostnames to serve on
+	AcceptIPs         bool              `json:"acceptIPs"`         // serve on raw IP addresses too, for phones without DNS - default true
+	CanonicalRedirect bool              `json:"canonicalRedirect"` // redirect the other hostnames and IPs to hostname
+	RaceName          string            `json:"raceName"`          // Name of the race, default Campus Life 5k Orchard Run
+	Distance          string            `json:"distance"`          // Distance of the race for display, e.g. 5k
+	SendgridUser      string            `json:"sendgridUser"`      // the Sendgrid user for e-mail integration
+	SendgridPass      string            `json:"sendgridPass"`      // the Sendgrid password for e-mail integration
+	EmailField        string            `json:"emailField"`        // the title of the Email field in the uploaded CSV - default Email
+	EmailFrom         string            `json:"emailFrom"`         // the from address for the e-mail integration
+	AdminToken        string            `json:"adminToken"`        // shared secret to log in as an admin - generated on startup if not set
+	TimerToken        string            `json:"timerToken"`        // shared secret to log in as a timer/scanner, disabled if not set
+	RegistrationToken string            `json:"registrationToken"` // shared secret to log in as registration, disabled if not set
+	DataDir           string            `json:"dataDir"`           // where racergo writes the files it generates - default data
+	Dev               bool              `json:"dev"`               // reload the templates and static files from the dirs below instead of the built in ones
+	TemplateDir       string            `json:"templateDir"`       // where raceResults.template and error.template are in dev mode - default .
+	StaticDir         string            `json:"staticDir"`         // served as /static/ in dev mode - default static
+	FontsDir          string            `json:"fontsDir"`          // served as /fonts/ in dev mode - default fonts
+	OverrideDir       string            `json:"overrideDir"`       // this race's templates, static/ and fonts/ files that replace the built in ones
+	PublicRequests    int               `json:"publicRequests"`    // spectators' requests handled at once - default one less than the cpus
+	PublicQueue       int               `json:"publicQueue"`       // spectators' requests waiting before more get a 503 - default 4 times publicRequests
+	LogLevel          string            `json:"logLevel"`          // debug, info, warn or error - default info, debug adds the race clock every second
+	LogFormat         string            `json:"logFormat"`         // text (logfmt) or json - default text
+	EventLog          string            `json:"eventLog"`          // file every change to the race is appended to - default race-events.log in dataDir
+	Rehearsal         float64           `json:"rehearsal"`         // run the race clock this many times faster than real time to practice - default 0, real time
+
+	generatedAdminToken string // the admin token defaultConfig made up, the only one that's ever logged
+}
+
+const defaultHTTPAddr = ":80"
+const fallbackHTTPAddr = ":8080"
+
+var config = defaultConfig()
+
+// defaultConfig fills in the defaults, some of which can be overridden by RACERGO* environment variables
+func defaultConfig() Config {
+	c := Config{
+		HTTPAddr:          defaultHTTPAddr,
+		HTTPSAddr:         ":443",
+		WebserverHostname: env.StringDefault("RACERGOHOSTNAME", "localhost:8080"),
+		RaceName:          env.StringDefault("RACERGORACENAME", "Set RACERGORACENAME environment variable to change race name"),
+		SendgridUser:      env.StringDefault("RACERGOSENDGRIDUSER", SENDGRIDUSER),
+		SendgridPass:      env.StringDefault("RACERGOSENDGRIDPASS", SENDGRIDPASS),
+		EmailField:        env.StringDefault("RACERGOEMAILFIELD", "Email"),
+		EmailFrom:         env.StringDefault("RACERGOFROMEMAIL", "racergo@nonexistenthost.com"),
+		AdminToken:        env.StringDefault("RACERGOADMINTOKEN", ""),
+		TimerToken:        env.StringDefault("RACERGOTIMERTOKEN", ""),
+		RegistrationToken: env.StringDefault("RACERGOREGISTRATIONTOKEN", ""),
+		AcceptIPs:         true,
+		MDNS:              true,
+		DataDir:           "data",
+		TemplateDir:       ".",
+		StaticDir:         "static",
+		FontsDir:          "fonts",
+		LogLevel:          env.StringDefault("RACERGOLOGLEVEL", "info"),
+		LogFormat:         "text",
+	}
+	if c.AdminToken == "" {
+		token, err := randomToken()
+		if err != nil {
+			panic(fmt.Sprintf("Error generating admin token - %s", err))
+		}
+		c.AdminToken = token
+		c.generatedAdminToken = token
+	}
+	return c
+}
+
+// adminTokenGenerated is whether the admin token is one racergo made up, which has to be shown so anyone can log in,
+// one the operator set they already know and shouldn't end up in the logs
+func (c Config) adminTokenGenerated() bool {
+	return c.generatedAdminToken != "" && c.AdminToken == c.generatedAdminToken
+}
+
+// stringList is a flag that can be given more than once or as a comma separated list
+type stringList struct {
+	list *[]string
+}
+
+func (sl stringList) String() string {
+	if sl.list == nil {
+		return ""
+	}
+	return strings.Join(*sl.list, ",")
+}
+
+func (sl stringList) Set(val string) error {
+	for _, v := range strings.Split(val, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*sl.list = append(*sl.list, v)
+		}
+	}
+	return nil
+}
+
+// mapFlag is a flag of key=value pairs that can be given more than once or as a comma separated list
+type mapFlag struct {
+	m *map[string]string
+}
+
+func (mf mapFlag) String() string {
+	if mf.m == nil {
+		return ""
+	}
+	var pairs []string
+	for k, v := range *mf.m {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (mf mapFlag) Set(val string) error {
+	for _, pair := range strings.Split(val, ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			return fmt.Errorf("%q should be key=value", pair)
+		}
+		if *mf.m == nil {
+			*mf.m = make(map[string]string)
+		}
+		(*mf.m)[k] = v
+	}
+	return nil
+}
+
+func configFlags(c *Config, configFile *string) *flag.FlagSet {
+	fs := flag.NewFlagSet("racergo", flag.ContinueOnError)
+	fs.StringVar(configFile, "config", "", "JSON config file, flags override its settings")
+	fs.StringVar(&c.HTTPAddr, "http", c.HTTPAddr, "address to serve http on")
+	fs.StringVar(&c.HTTPSAddr, "https", c.HTTPSAddr, "address to serve https on, blank to disable")
+	fs.StringVar(&c.TLSCert, "tls-cert", c.TLSCert, "certificate file for https, generated with a local CA if not set")
+	fs.StringVar(&c.TLSKey, "tls-key", c.TLSKey, "key file for https, generated with a local CA if not set")
+	fs.BoolVar(&c.RedirectHTTPS, "redirect-https", c.RedirectHTTPS, "redirect http requests to https")
+	fs.StringVar(&c.WebserverHostname, "hostname", c.WebserverHostname, "hostname racergo is reached at")
+	fs.StringVar(&c.DNSAddr, "dns", c.DNSAddr, "address to answer DNS queries for the hostnames on, e.g. :53")
+	fs.BoolVar(&c.DNSCatchAll, "dns-catch-all", c.DNSCatchAll, "answer DNS queries for every name, captive portal style")
+	fs.StringVar(&c.DNSIP, "dns-ip", c.DNSIP, "address DNS answers with, default the LAN address the query came in on")
+	fs.BoolVar(&c.MDNS, "mdns", c.MDNS, "advertise racergo on the LAN as <hostname>.local with mDNS/DNS-SD")
+	fs.Var(mapFlag{&c.Captive}, "captive", "how to answer phones checking for a captive portal, e.g. android=portal,apple=online,windows=off")
+	fs.Var(stringList{&c.Hostnames}, "alias", "other hostnames to serve on, may be repeated")
+	fs.BoolVar(&c.AcceptIPs, "accept-ips", c.AcceptIPs, "serve on raw IP addresses too, for phones without DNS")
+	fs.BoolVar(&c.CanonicalRedirect, "canonical-redirect", c.CanonicalRedirect, "redirect the aliases and IP addresses to the hostname")
+	fs.StringVar(&c.RaceName, "race-name", c.RaceName, "name of the race")
+	fs.StringVar(&c.Distance, "distance", c.Distance, "distance of the race, e.g. 5k")
+	fs.StringVar(&c.SendgridUser, "sendgrid-user", c.SendgridUser, "Sendgrid user for e-mailing results")
+	fs.StringVar(&c.SendgridPass, "sendgrid-pass", c.SendgridPass, "Sendgrid password for e-mailing results")
+	fs.StringVar(&c.EmailField, "email-field", c.EmailField, "title of the e-mail column in the uploaded CSV")
+	fs.StringVar(&c.EmailFrom, "email-from", c.EmailFrom, "from address for e-mailed results")
+	fs.StringVar(&c.AdminToken, "admin-token", c.AdminToken, "shared secret to log in as an admin")
+	fs.StringVar(&c.TimerToken, "timer-token", c.TimerToken, "shared secret to log in as a timer/scanner")
+	fs.StringVar(&c.RegistrationToken, "registration-token", c.RegistrationToken, "shared secret to log in as registration")
+	fs.StringVar(&c.DataDir, "data", c.DataDir, "directory racergo writes its files to")
+	fs.BoolVar(&c.Dev, "dev", c.Dev, "reload the templates and static files from disk on every request instead of using the built in ones")
+	fs.StringVar(&c.TemplateDir, "templates", c.TemplateDir, "directory containing raceResults.template and error.template, with -dev")
+	fs.StringVar(&c.StaticDir, "static", c.StaticDir, "directory served as /static/, with -dev")
+	fs.StringVar(&c.FontsDir, "fonts", c.FontsDir, "directory served as /fonts/, with -dev")
+	fs.StringVar(&c.OverrideDir, "overrides", c.OverrideDir, "directory of templates and static/ and fonts/ files that replace the built in ones for this race")
+	fs.IntVar(&c.PublicRequests, "public-requests", c.PublicRequests, "spectators' requests handled at once, 0 for one less than the cpus")
+	fs.StringVar(&c.LogLevel, "log-level", c.LogLevel, "debug, info, warn or error, debug adds the race clock every second")
+	fs.StringVar(&c.LogFormat, "log-format", c.LogFormat, "text (logfmt) or json")
+	fs.StringVar(&c.EventLog, "event-log", c.EventLog, "file every change to the race is appended to, default race-events.log in the data directory")
+	fs.IntVar(&c.PublicQueue, "public-queue", c.PublicQueue, "spectators' requests that wait for a turn before more are told to retry, 0 for 4 times -public-requests")
+	fs.Float64Var(&c.Rehearsal, "rehearsal", c.Rehearsal, "run the race clock this many times faster than real time to practice, e.g. 10, never on race day")
+	return fs
+}
+
+// LoadConfig applies the config file and then flags from args on top of c
+func LoadConfig(c *Config, args []string) error {
+	var configFile string
+	fs := configFlags(c, &configFile)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("Unexpected arguments - %s", strings.Join(fs.Args(), " "))
+	}
+	if configFile == "" {
+		return nil
+	}
+	f, err := os.Open(configFile)
+	if err != nil {
+		return fmt.Errorf("Error opening config file - %v", err)
+	}
+	defer f.Close()
+	err = decodeConfig(f, c)
+	if err != nil {
+		return fmt.Errorf("Error reading config file %s - %v", configFile, err)
+	}
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "alias" {
+			c.Hostnames = nil // the command line wins over the file, they're added back below
+		}
+	})
+	// parse again so flags override the file
+	return configFlags(c, &configFile).Parse(args)
+}
+
+func decodeConfig(r io.Reader, c *Config) error {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	return dec.Decode(c)
+}
+
+// Validate reports every problem with the config at once
+func (c Config) Validate() error {
+	var errs []error
+	checkAddr := func(name, addr string) {
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			errs = append(errs, fmt.Errorf("%s %q is not a valid address - %v", name, addr, err))
+		}
+	}
+	checkHostname := func(name, host string) {
+		if host == "" || strings.ContainsAny(host, "/ ") {
+			errs = append(errs, fmt.Errorf("%s %q must be a hostname, optionally with a port, and no scheme or path", name, host))
+		}
+	}
+	checkDir := func(name, dir string, files ...string) {
+		info, err := os.Stat(dir)
+		if err != nil || !info.IsDir() {
+			errs = append(errs, fmt.Errorf("%s %q is not a directory", name, dir))
+			return
+		}
+		for _, f := range files {
+			if _, err := os.Stat(filepath.Join(dir, f)); err != nil {
+				errs = append(errs, fmt.Errorf("%s %q is missing %s", name, dir, f))
+			}
+		}
+	}
+	checkAddr("httpAddr", c.HTTPAddr)
+	if c.HTTPSAddr != "" {
+		checkAddr("httpsAddr", c.HTTPSAddr)
+		if (c.TLSCert == "") != (c.TLSKey == "") {
+			errs = append(errs, fmt.Errorf("tlsCert and tlsKey must be set together"))
+		} else if c.TLSCert != "" {
+			for name, f := range map[string]string{"tlsCert": c.TLSCert, "tlsKey": c.TLSKey} {
+				if _, err := os.Stat(f); err != nil {
+					errs = append(errs, fmt.Errorf("%s %q can't be read - %v", name, f, err))
+				}
+			}
+		}
+	} else if c.RedirectHTTPS {
+		errs = append(errs, fmt.Errorf("redirectHTTPS needs httpsAddr"))
+	}
+	if c.DNSAddr != "" {
+		checkAddr("dnsAddr", c.DNSAddr)
+	}
+	if c.DNSIP != "" && net.ParseIP(c.DNSIP) == nil {
+		errs = append(errs, fmt.Errorf("dnsIP %q is not an IP address", c.DNSIP))
+	}
+	for platform, mode := range c.Captive {
+		if _, ok := captivePlatforms[platform]; !ok {
+			errs = append(errs, fmt.Errorf("captive platform %q must be one of android, apple, windows or firefox", platform))
+		}
+		if mode != captiveOnline && mode != captivePortal && mode != captiveOff {
+			errs = append(errs, fmt.Errorf("captive mode %q for %s must be online, portal or off", mode, platform))
+		}
+	}
+	checkHostname("hostname", c.WebserverHostname)
+	for _, h := range c.Hostnames {
+		checkHostname("hostnames", h)
+	}
+	if c.RaceName == "" {
+		errs = append(errs, fmt.Errorf("raceName must be set"))
+	}
+	if c.EmailField == "" {
+		errs = append(errs, fmt.Errorf("emailField must be set"))
+	}
+	if _, err := mail.ParseAddress(c.EmailFrom); err != nil {
+		errs = append(errs, fmt.Errorf("emailFrom %q is not a valid address - %v", c.EmailFrom, err))
+	}
+	if c.AdminToken == "" {
+		errs = append(errs, fmt.Errorf("adminToken must be set"))
+	}
+	if info, err := os.Stat(c.DataDir); err == nil && !info.IsDir() {
+		errs = append(errs, fmt.Errorf("dataDir %q is not a directory", c.DataDir))
+	}
+	if c.Dev {
+		checkDir("templateDir", c.TemplateDir, "raceResults.template", "error.template")
+		checkDir("staticDir", c.StaticDir)
+		checkDir("fontsDir", c.FontsDir)
+	}
+	if c.OverrideDir != "" {
+		checkDir("overrideDir", c.OverrideDir)
+	}
+	if c.PublicRequests < 0 {
+		errs = append(errs, fmt.Errorf("publicRequests %d can't be negative", c.PublicRequests))
+	}
+	if c.PublicQueue < 0 {
+		errs = append(errs, fmt.Errorf("publicQueue %d can't be negative", c.PublicQueue))
+	}
+	if c.Rehearsal < 0 {
+		errs = append(errs, fmt.Errorf("rehearsal %g can't be negative", c.Rehearsal))
+	}
+	if _, err := newLogHandler(io.Discard, c.LogFormat, c.LogLevel); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// eventLogFile is where the race's event log goes
+func (c Config) eventLogFile() string {
+	if c.EventLog != "" {
+		return c.EventLog
+	}
+	return filepath.Join(c.DataDir, "race-events.log")
+}
+
+// HostNames are the hostnames racergo is reached at without their ports, raw IP addresses are skipped
+func (c Config) HostNames() []string {
+	var names []string
+	for _, h := range append([]string{c.WebserverHostname}, c.Hostnames...) {
+		if host, _, err := net.SplitHostPort(h); err == nil {
+			h = host
+		}
+		if net.ParseIP(h) == nil {
+			names = append(names, strings.ToLower(h))
+		}
+	}
+	return names
+}
+
+// Redacted is the config with the secrets hidden so it can be printed
+func (c Config) Redacted() Config {
+	for _, secret := range []*string{&c.SendgridPass, &c.AdminToken, &c.TimerToken, &c.RegistrationToken} {
+		if *secret != "" {
+			*secret = "********"
+		}
+	}
+	return c
+}
+
+// checkConfig is racergo config check, it prints the config that would be used and any problems with it
+func checkConfig(w io.Writer, args []string) error {
+	c := config
+	c.Captive = maps.Clone(config.Captive)
+	if err := LoadConfig(&c, args); err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	if err := enc.Encode(c.Redacted()); err != nil {
+		return err
+	}
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	if _, _, err := parseTemplates(c.templateFS()); err != nil {
+		return err
+	}
+	fmt.Fprintln(w, "Configuration OK")
+	return nil
+}
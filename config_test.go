@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeConfigFile(t *testing.T, contents string) string {
+	name := filepath.Join(t.TempDir(), "racergo.json")
+	if err := os.WriteFile(name, []byte(contents), 0600); err != nil {
+		t.Fatalf("Error writing config file - %v", err)
+	}
+	return name
+}
+
+func TestLoadConfig(t *testing.T) {
+	file := writeConfigFile(t, `{"raceName":"File Race","distance":"10k","hostnames":["file.example"],"timerToken":"fromfile"}`)
+	c := defaultConfig()
+	err := LoadConfig(&c, []string{"-config", file, "-race-name", "Flag Race", "-http", ":9090"})
+	if err != nil {
+		t.Fatalf("Error loading config - %v", err)
+	}
+	if c.RaceName != "Flag Race" {
+		t.Errorf("Flags should override the config file, got race name %q", c.RaceName)
+	}
+	if c.Distance != "10k" || c.TimerToken != "fromfile" || c.HTTPAddr != ":9090" {
+		t.Errorf("Expected settings from both the file and flags, got %#v", c)
+	}
+	if !reflect.DeepEqual(c.Hostnames, []string{"file.example"}) {
+		t.Errorf("Expected hostnames from the file, got %v", c.Hostnames)
+	}
+
+	c = defaultConfig()
+	err = LoadConfig(&c, []string{"-alias", "a.example,b.example", "-config", file, "-alias", "c.example"})
+	if err != nil {
+		t.Fatalf("Error loading config - %v", err)
+	}
+	if !reflect.DeepEqual(c.Hostnames, []string{"a.example", "b.example", "c.example"}) {
+		t.Errorf("Expected hostnames from the flags only, got %v", c.Hostnames)
+	}
+
+	c = defaultConfig()
+	if err = LoadConfig(&c, []string{"-config", writeConfigFile(t, `{"raceNmae":"typo"}`)}); err == nil {
+		t.Errorf("Expected an error for an unknown setting in the config file")
+	}
+	c = defaultConfig()
+	if err = LoadConfig(&c, []string{"-config", filepath.Join(t.TempDir(), "missing.json")}); err == nil {
+		t.Errorf("Expected an error for a missing config file")
+	}
+	c = defaultConfig()
+	if err = LoadConfig(&c, []string{"extra"}); err == nil {
+		t.Errorf("Expected an error for unexpected arguments")
+	}
+}
+
+func TestAdminTokenGenerated(t *testing.T) {
+	t.Setenv("RACERGOADMINTOKEN", "")
+	c := defaultConfig()
+	if c.AdminToken == "" || !c.adminTokenGenerated() {
+		t.Errorf("Expected an admin token to be generated")
+	}
+	if err := LoadConfig(&c, []string{"-admin-token", "supersecret"}); err != nil {
+		t.Fatalf("Error loading config - %v", err)
+	}
+	if c.adminTokenGenerated() {
+		t.Errorf("Expected the operator's admin token not to count as generated")
+	}
+	t.Setenv("RACERGOADMINTOKEN", "fromenv")
+	if c = defaultConfig(); c.adminTokenGenerated() {
+		t.Errorf("Expected the admin token from the environment not to count as generated")
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	c := defaultConfig()
+	c.HTTPSAddr = ""
+	if err := c.Validate(); err != nil {
+		t.Fatalf("Expected the default config to be valid, got %v", err)
+	}
+	c.HTTPAddr = "80"
+	c.WebserverHostname = "http://raceresults/"
+	c.EmailFrom = "not an address"
+	c.Dev = true
+	c.TemplateDir = t.TempDir()
+	c.OverrideDir = filepath.Join(t.TempDir(), "missing")
+	c.HTTPSAddr = ":443"
+	c.TLSCert = filepath.Join(t.TempDir(), "missing.cert")
+	c.PublicQueue = -1
+	c.LogLevel = "loud"
+	c.Rehearsal = -10
+	err := c.Validate()
+	if err == nil {
+		t.Fatalf("Expected errors validating the config")
+	}
+	for _, want := range []string{"httpAddr", "hostname", "emailFrom", "raceResults.template", "overrideDir", "tlsCert", "publicQueue", "logLevel", "rehearsal"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected an error about %s, got %v", want, err)
+		}
+	}
+}
+
+func TestCheckConfig(t *testing.T) {
+	buf := &bytes.Buffer{}
+	err := checkConfig(buf, []string{"-https", "", "-admin-token", "supersecret", "-race-name", "Checked Race"})
+	if err != nil {
+		t.Fatalf("Expected the config to check ok, got %v\n%s", err, buf.String())
+	}
+	out := buf.String()
+	if strings.Contains(out, "supersecret") {
+		t.Errorf("Secrets should be redacted from config check output, got %s", out)
+	}
+	if !strings.Contains(out, "Checked Race") || !strings.Contains(out, "Configuration OK") {
+		t.Errorf("Expected the config and an OK, got %s", out)
+	}
+	if config.RaceName == "Checked Race" {
+		t.Errorf("config check should not change the running config")
+	}
+	buf.Reset()
+	if err = checkConfig(buf, []string{"-race-name", ""}); err == nil {
+		t.Errorf("Expected an error checking an invalid config, got %s", buf.String())
+	}
+}
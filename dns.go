@@ -0,0 +1,151 @@
+package main
+
+import (
+	"log/slog"
+	"net"
+	"strings"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const dnsTTL = 60 // seconds, short so phones pick up a changed address quickly
+
+// DNSServer answers A and AAAA queries for the race hostnames with racergo's own address so the hotspot
+// doesn't need any other DNS, with catchAll every name resolves to racergo like a captive portal
+type DNSServer struct {
+	names    map[string]bool // fully qualified and lower case
+	catchAll bool
+	ip       net.IP // fixed answer, nil to answer with the address the query came in on
+}
+
+func NewDNSServer(hostnames []string, catchAll bool, ip net.IP) *DNSServer {
+	ds := &DNSServer{
+		names:    make(map[string]bool),
+		catchAll: catchAll,
+		ip:       ip,
+	}
+	for _, h := range hostnames {
+		ds.names[strings.ToLower(strings.TrimSuffix(h, "."))+"."] = true
+	}
+	return ds
+}
+
+// Serve answers queries on conn until it's closed
+func (ds *DNSServer) Serve(conn net.PacketConn) error {
+	buf := make([]byte, 512)
+	for {
+		n, client, err := conn.ReadFrom(buf)
+		if err != nil {
+			return err
+		}
+		resp, err := ds.answer(buf[:n], client)
+		if err != nil {
+			continue // not a query we can parse, ignore it like any other DNS server would
+		}
+		if _, err = conn.WriteTo(resp, client); err != nil {
+			slog.Warn("Error answering DNS query", "client", client, "err", err)
+		}
+	}
+}
+
+func (ds *DNSServer) answer(query []byte, client net.Addr) ([]byte, error) {
+	var p dnsmessage.Parser
+	header, err := p.Start(query)
+	if err != nil {
+		return nil, err
+	}
+	q, err := p.Question()
+	if err != nil {
+		return nil, err
+	}
+	rcode := dnsmessage.RCodeSuccess
+	if header.Response || header.OpCode != 0 {
+		rcode = dnsmessage.RCodeNotImplemented
+	} else if !ds.catchAll && !ds.names[strings.ToLower(q.Name.String())] {
+		rcode = dnsmessage.RCodeNameError
+	}
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{
+		ID:               header.ID,
+		Response:         true,
+		OpCode:           header.OpCode,
+		Authoritative:    rcode != dnsmessage.RCodeNotImplemented,
+		RecursionDesired: header.RecursionDesired,
+		RCode:            rcode,
+	})
+	b.EnableCompression()
+	if err = b.StartQuestions(); err != nil {
+		return nil, err
+	}
+	if err = b.Question(q); err != nil {
+		return nil, err
+	}
+	if err = b.StartAnswers(); err != nil {
+		return nil, err
+	}
+	if rcode == dnsmessage.RCodeSuccess && q.Class == dnsmessage.ClassINET {
+		rh := dnsmessage.ResourceHeader{Name: q.Name, Class: dnsmessage.ClassINET, TTL: dnsTTL}
+		switch q.Type {
+		case dnsmessage.TypeA:
+			if ip := ds.address(client, true); ip != nil {
+				var a dnsmessage.AResource
+				copy(a.A[:], ip.To4())
+				err = b.AResource(rh, a)
+			}
+		case dnsmessage.TypeAAAA:
+			if ip := ds.address(client, false); ip != nil {
+				var aaaa dnsmessage.AAAAResource
+				copy(aaaa.AAAA[:], ip.To16())
+				err = b.AAAAResource(rh, aaaa)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return b.Finish()
+}
+
+// address picks the IPv4 or IPv6 address the client can reach racergo at, preferring the one the kernel
+// would route replies to the client from, nil if racergo has no address of that family
+func (ds *DNSServer) address(client net.Addr, v4 bool) net.IP {
+	var candidates []net.IP
+	if ds.ip != nil {
+		candidates = append(candidates, ds.ip)
+	} else {
+		if udp, ok := client.(*net.UDPAddr); ok {
+			// connecting a udp socket sends nothing, it only asks the kernel which local address it would use
+			if conn, err := net.DialUDP("udp", nil, udp); err == nil {
+				candidates = append(candidates, conn.LocalAddr().(*net.UDPAddr).IP)
+				conn.Close()
+			}
+		}
+		for _, ip := range lanIPs() {
+			if !ip.IsLoopback() {
+				candidates = append(candidates, ip)
+			}
+		}
+	}
+	for _, ip := range candidates {
+		if (ip.To4() != nil) == v4 {
+			return ip
+		}
+	}
+	return nil
+}
+
+// serveDNS runs the DNS server from the config, racergo keeps running without it if the port can't be used
+func serveDNS() {
+	conn, err := net.ListenPacket("udp", config.DNSAddr)
+	if err != nil {
+		slog.Error("Error listening for DNS, DNS disabled", "addr", config.DNSAddr, "err", err)
+		return
+	}
+	names := config.HostNames()
+	if config.DNSCatchAll {
+		slog.Info("Answering DNS for every name", "addr", config.DNSAddr)
+	} else {
+		slog.Info("Answering DNS", "addr", config.DNSAddr, "names", strings.Join(names, ", "))
+	}
+	err = NewDNSServer(names, config.DNSCatchAll, net.ParseIP(config.DNSIP)).Serve(conn)
+	slog.Warn("DNS server stopped", "addr", config.DNSAddr, "err", err)
+}
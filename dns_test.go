@@ -0,0 +1,90 @@
+package main
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// dnsQuery sends a single query to the server on addr and returns the response
+func dnsQuery(t *testing.T, addr string, name string, qtype dnsmessage.Type) dnsmessage.Message {
+	query := dnsmessage.Message{
+		Header: dnsmessage.Header{ID: 42, RecursionDesired: true},
+		Questions: []dnsmessage.Question{{
+			Name:  dnsmessage.MustNewName(name),
+			Type:  qtype,
+			Class: dnsmessage.ClassINET,
+		}},
+	}
+	packed, err := query.Pack()
+	if err != nil {
+		t.Fatalf("Error packing query - %v", err)
+	}
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		t.Fatalf("Error dialing DNS server - %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(time.Second * 5))
+	if _, err = conn.Write(packed); err != nil {
+		t.Fatalf("Error sending query - %v", err)
+	}
+	buf := make([]byte, 512)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("Error reading response - %v", err)
+	}
+	var resp dnsmessage.Message
+	if err = resp.Unpack(buf[:n]); err != nil {
+		t.Fatalf("Error unpacking response - %v", err)
+	}
+	if resp.Header.ID != 42 || !resp.Header.Response {
+		t.Errorf("Expected a response to query 42, got %#v", resp.Header)
+	}
+	return resp
+}
+
+func startDNS(t *testing.T, ds *DNSServer) string {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error listening for DNS - %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	go ds.Serve(conn)
+	return conn.LocalAddr().String()
+}
+
+func TestDNS(t *testing.T) {
+	addr := startDNS(t, NewDNSServer([]string{"RaceResults"}, false, nil))
+	resp := dnsQuery(t, addr, "raceresults.", dnsmessage.TypeA)
+	if resp.Header.RCode != dnsmessage.RCodeSuccess || len(resp.Answers) != 1 {
+		t.Fatalf("Expected one answer for the hostname, got %v %v", resp.Header.RCode, resp.Answers)
+	}
+	a, ok := resp.Answers[0].Body.(*dnsmessage.AResource)
+	if !ok || net.IP(a.A[:]).String() != "127.0.0.1" {
+		t.Errorf("Expected the address the query came in on, got %v", resp.Answers[0].Body)
+	}
+	resp = dnsQuery(t, addr, "example.com.", dnsmessage.TypeA)
+	if resp.Header.RCode != dnsmessage.RCodeNameError || len(resp.Answers) != 0 {
+		t.Errorf("Expected no such name for other hosts, got %v %v", resp.Header.RCode, resp.Answers)
+	}
+	resp = dnsQuery(t, addr, "raceresults.", dnsmessage.TypeMX)
+	if resp.Header.RCode != dnsmessage.RCodeSuccess || len(resp.Answers) != 0 {
+		t.Errorf("Expected no records for other types, got %v %v", resp.Header.RCode, resp.Answers)
+	}
+
+	addr = startDNS(t, NewDNSServer([]string{"raceresults"}, true, net.ParseIP("10.1.2.3")))
+	resp = dnsQuery(t, addr, "connectivitycheck.gstatic.com.", dnsmessage.TypeA)
+	if len(resp.Answers) != 1 {
+		t.Fatalf("Expected catch all to answer every name, got %v %v", resp.Header.RCode, resp.Answers)
+	}
+	if a, ok := resp.Answers[0].Body.(*dnsmessage.AResource); !ok || net.IP(a.A[:]).String() != "10.1.2.3" {
+		t.Errorf("Expected the configured address, got %v", resp.Answers[0].Body)
+	}
+	resp = dnsQuery(t, addr, "raceresults.", dnsmessage.TypeAAAA)
+	if resp.Header.RCode != dnsmessage.RCodeSuccess || len(resp.Answers) != 0 {
+		t.Errorf("Expected no IPv6 answer for an IPv4 address, got %v %v", resp.Header.RCode, resp.Answers)
+	}
+}
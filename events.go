@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const eventsKeepAlive = time.Second * 30 // so proxies and phones don't drop an idle connection
+
+// Broadcaster fans race events out to every client connected to /events
+type Broadcaster struct {
+	clients map[chan string]bool
+	closed  bool
+	sync.Mutex
+}
+
+func NewBroadcaster() *Broadcaster {
+	return &Broadcaster{
+		clients: make(map[chan string]bool),
+	}
+}
+
+// Subscribe returns a channel of server-sent events, it's closed when the broadcaster is
+func (b *Broadcaster) Subscribe() chan string {
+	b.Lock()
+	defer b.Unlock()
+	c := make(chan string, 16)
+	if b.closed {
+		close(c)
+		return c
+	}
+	b.clients[c] = true
+	return c
+}
+
+func (b *Broadcaster) Unsubscribe(c chan string) {
+	b.Lock()
+	defer b.Unlock()
+	if b.clients[c] {
+		delete(b.clients, c)
+		close(c)
+	}
+}
+
+// Publish sends the event to every client, a client too far behind to take it misses it rather than holding up the race
+func (b *Broadcaster) Publish(event string, data interface{}) {
+	b.Lock()
+	defer b.Unlock()
+	msg := fmt.Sprintf("event: %s\ndata: %v\n\n", event, data)
+	for c := range b.clients {
+		select {
+		case c <- msg:
+		default:
+		}
+	}
+}
+
+// Close disconnects every client, it's called on shutdown so the open connections don't hold it up
+func (b *Broadcaster) Close() {
+	b.Lock()
+	defer b.Unlock()
+	for c := range b.clients {
+		delete(b.clients, c)
+		close(c)
+	}
+	b.closed = true
+}
+
+// unixMillis is how times are sent to the browser, 0 for no time
+func unixMillis(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixMilli()
+}
+
+// eventsHandler streams the start and schedule of the race as server-sent events, starting with the current state
+func eventsHandler(w http.ResponseWriter, r *http.Request, race *Race) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	events := race.events.Subscribe()
+	defer race.events.Unsubscribe(events)
+	race.RLock()
+	started, scheduled := race.started, race.scheduled
+	race.RUnlock()
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	fmt.Fprintf(w, "event: now\ndata: %d\n\n", unixMillis(race.GetTime())) // a page from the browser's cache has an old NowMillis
+	if started.IsZero() {
+		fmt.Fprintf(w, "event: schedule\ndata: %d\n\n", unixMillis(scheduled))
+	} else {
+		fmt.Fprintf(w, "event: start\ndata: %d\n\n", unixMillis(started))
+	}
+	flusher.Flush()
+	keepAlive := time.NewTicker(eventsKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case msg, ok := <-events:
+			if !ok {
+				return
+			}
+			fmt.Fprint(w, msg)
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case <-r.Context().Done():
+			return
+		}
+		flusher.Flush()
+	}
+}
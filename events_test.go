@@ -0,0 +1,302 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestScheduleStart(t *testing.T) {
+	now := time.Now()
+	clock := NewManualClock(now)
+	race := NewRaceWithClock(clock)
+	if err := race.ScheduleStart(now.Add(-time.Second)); err == nil {
+		t.Errorf("Expected an error scheduling a start in the past")
+	}
+	if err := race.CancelScheduledStart(); err == nil {
+		t.Errorf("Expected an error cancelling a start that isn't scheduled")
+	}
+
+	at := now.Add(time.Millisecond * 50)
+	if err := race.ScheduleStart(now.Add(time.Hour)); err != nil {
+		t.Fatalf("Error scheduling start - %v", err)
+	}
+	if err := race.ScheduleStart(at); err != nil {
+		t.Fatalf("Error rescheduling start - %v", err)
+	}
+	clock.Advance(time.Millisecond * 49)
+	if !race.Snapshot().Started.IsZero() {
+		t.Fatalf("Expected the race not to start before the scheduled time")
+	}
+	clock.Advance(time.Millisecond)
+	race.RLock()
+	started, scheduled := race.started, race.scheduled
+	race.RUnlock()
+	if !started.Equal(at) {
+		t.Errorf("Expected the race to start at exactly the scheduled time %s, got %s", at, started)
+	}
+	if !scheduled.IsZero() {
+		t.Errorf("Expected the schedule to be cleared once started, got %s", scheduled)
+	}
+	if err := race.ScheduleStart(now.Add(time.Hour)); err == nil {
+		t.Errorf("Expected an error scheduling a started race")
+	}
+	clock.Advance(time.Second)
+	if err := race.Start(nil); err == nil {
+		t.Errorf("Expected an error starting a started race again")
+	}
+
+	// go now overrides the schedule
+	clock = NewManualClock(now)
+	race = NewRaceWithClock(clock)
+	if err := race.ScheduleStart(now.Add(time.Millisecond * 50)); err != nil {
+		t.Fatalf("Error scheduling start - %v", err)
+	}
+	if err := race.Start(nil); err != nil {
+		t.Fatalf("Error starting race now - %v", err)
+	}
+	clock.Advance(time.Millisecond * 100)
+	if !race.started.Equal(now) || !race.scheduled.IsZero() {
+		t.Errorf("Expected the race to start now and not at the schedule, got %s scheduled %s", race.started, race.scheduled)
+	}
+}
+
+func TestScheduleStartHandler(t *testing.T) {
+	now := time.Date(2026, 10, 19, 7, 30, 0, 0, time.Local)
+	race := NewRaceWithClock(NewManualClock(now))
+	for _, test := range []struct {
+		values    url.Values
+		code      int
+		scheduled time.Time
+	}{
+		{url.Values{"at": {"08:00"}}, 301, time.Date(2026, 10, 19, 8, 0, 0, 0, time.Local)},
+		{url.Values{"at": {"2026-10-19T08:15:30"}}, 301, time.Date(2026, 10, 19, 8, 15, 30, 0, time.Local)},
+		{url.Values{"in": {"5m"}}, 301, now.Add(time.Minute * 5)},
+		{url.Values{"at": {"07:00"}}, 409, now.Add(time.Minute * 5)},
+		{url.Values{"at": {"soon"}}, 409, now.Add(time.Minute * 5)},
+		{url.Values{"cancel": {"true"}}, 301, time.Time{}},
+	} {
+		r, _ := http.NewRequest("POST", "/scheduleStart?"+test.values.Encode(), nil)
+		w := httptest.NewRecorder()
+		scheduleStartHandler(w, r, race)
+		if w.Code != test.code {
+			t.Errorf("%v - expected %d, got %d - %s", test.values, test.code, w.Code, w.Body.String())
+		}
+		if !race.scheduled.Equal(test.scheduled) {
+			t.Errorf("%v - expected scheduled at %s, got %s", test.values, test.scheduled, race.scheduled)
+		}
+	}
+}
+
+func TestEvents(t *testing.T) {
+	now := time.Now()
+	race := NewRaceWithClock(NewManualClock(now))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		eventsHandler(w, r, race)
+	}))
+	defer srv.Close()
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("Error connecting to events - %v", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Expected an event stream, got %s", ct)
+	}
+	lines := bufio.NewScanner(resp.Body)
+	next := func() string {
+		var event []string
+		for lines.Scan() && lines.Text() != "" {
+			event = append(event, lines.Text())
+		}
+		return strings.Join(event, "\n")
+	}
+	if event := next(); !strings.HasPrefix(event, "event: now\ndata: ") {
+		t.Errorf("Expected the server's clock first, got %q", event)
+	}
+	if event := next(); event != "event: schedule\ndata: 0" {
+		t.Errorf("Expected the current schedule first, got %q", event)
+	}
+	at := now.Add(time.Hour)
+	race.ScheduleStart(at)
+	if event, want := next(), fmt.Sprintf("event: schedule\ndata: %d", at.UnixMilli()); event != want {
+		t.Errorf("Expected %q, got %q", want, event)
+	}
+	startRace(race)
+	if event, want := next(), fmt.Sprintf("event: start\ndata: %d", now.UnixMilli()); event != want {
+		t.Errorf("Expected %q, got %q", want, event)
+	}
+	race.events.Close()
+	if event := next(); event != "" {
+		t.Errorf("Expected the stream to end when the broadcaster closes, got %q", event)
+	}
+}
+
+func TestAdjustStart(t *testing.T) {
+	now := time.Date(2026, 10, 19, 7, 30, 0, 0, time.Local)
+	clock := NewManualClock(now)
+	race := NewRaceWithClock(clock)
+	for _, e := range []Entry{
+		{Bib: "1", Fname: "Matthew", Lname: "Zimmerman", Age: 34, Male: true},
+		{Bib: "2", Fname: "Sarah", Lname: "Smith", Age: 28},
+	} {
+		if err := race.AddEntry(e); err != nil {
+			t.Fatalf("Error adding entry - %v", err)
+		}
+	}
+	if err := race.AdjustStart(now); err == nil {
+		t.Errorf("Expected an error adjusting a race that hasn't started")
+	}
+	started := now
+	startRace(race)
+	for _, bib := range []Bib{"2", "1"} {
+		clock.Advance(time.Minute)
+		if err := race.RecordTimeForBib(bib); err != nil {
+			t.Fatalf("Error recording bib - %v", err)
+		}
+	}
+	adjust := func(values url.Values, code int) {
+		r, _ := http.NewRequest("POST", "/adjustStart?"+values.Encode(), nil)
+		w := httptest.NewRecorder()
+		adjustStartHandler(w, r, race)
+		if w.Code != code {
+			t.Errorf("%v - expected %d, got %d - %s", values, code, w.Code, w.Body.String())
+		}
+	}
+	adjust(url.Values{"offset": {"-2.5s"}}, 301)
+	adjust(url.Values{"offset": {"90s"}}, 409) // after bib 2 finished
+	adjust(url.Values{"at": {"07:30:01.50"}}, 301)
+	adjust(url.Values{"offset": {"soon"}}, 409)
+	race.RLock()
+	if want := started.Add(time.Millisecond * 1500); !race.started.Equal(want) {
+		t.Errorf("Expected the start moved to %s, got %s", want, race.started)
+	}
+	for x, want := range []time.Duration{time.Second * 58500 / 1000, time.Second * 118500 / 1000} {
+		entry := race.allEntries[x]
+		if time.Duration(entry.Duration) != want || !entry.TimeFinished.Equal(race.started.Add(want)) {
+			t.Errorf("Place %d - expected %s, got %s finished at %s", x+1, want, entry.Duration, entry.TimeFinished)
+		}
+	}
+	notes := 0
+	for _, audit := range race.auditLog {
+		if audit.Note != "" {
+			notes++
+		}
+	}
+	race.RUnlock()
+	if notes != 2 {
+		t.Errorf("Expected both adjustments in the audit log, got %d", notes)
+	}
+	var wg sync.WaitGroup
+	for x := 0; x < 2; x++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := race.AdjustStartBy(-time.Second); err != nil {
+				t.Errorf("Error adjusting the start - %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	race.RLock()
+	if want := started.Add(-time.Millisecond * 500); !race.started.Equal(want) {
+		t.Errorf("Expected both offsets to count, moving the start to %s, got %s", want, race.started)
+	}
+	race.RUnlock()
+
+	adjust(url.Values{"reset": {"true"}}, 301)
+	race.RLock()
+	if !race.started.IsZero() {
+		t.Errorf("Expected the start cleared after a reset, got %s", race.started)
+	}
+	for _, entry := range race.allEntries {
+		if entry.HasFinished() || !entry.TimeFinished.IsZero() {
+			t.Errorf("Expected bib %s's time cleared, got %s", entry.Bib, entry.Duration)
+		}
+	}
+	race.RUnlock()
+
+	startRace(race)
+	clock.Advance(time.Minute)
+	if err := race.RecordTimeForBib("1"); err != nil {
+		t.Fatalf("Error recording bib - %v", err)
+	}
+	if err := race.ConfirmTimeForBib("1"); err != nil {
+		t.Fatalf("Error confirming bib - %v", err)
+	}
+	adjust(url.Values{"reset": {"true"}}, 409)
+}
+
+func TestStartAt(t *testing.T) {
+	chicago, err := time.LoadLocation("America/Chicago")
+	if err != nil {
+		t.Skipf("No time zone database - %v", err)
+	}
+	now := time.Date(2026, 10, 19, 7, 30, 0, 0, chicago)
+	clock := NewManualClock(now)
+	race := NewRaceWithClock(clock)
+	if err := race.AddEntry(Entry{Bib: "1", Fname: "Jane", Lname: "Doe", Age: 30}); err != nil {
+		t.Fatalf("Error adding entry - %v", err)
+	}
+	startAt := func(values url.Values, code int) *httptest.ResponseRecorder {
+		r, _ := http.NewRequest("POST", "/startAt?"+values.Encode(), nil)
+		r.Header.Set("Accept", "application/json")
+		w := httptest.NewRecorder()
+		startAtHandler(w, r, race)
+		if w.Code != code {
+			t.Errorf("%v - expected %d, got %d - %s", values, code, w.Code, w.Body.String())
+		}
+		return w
+	}
+	startAt(url.Values{"at": {"07:31"}, "tz": {"America/Chicago"}}, 409) // in the future
+	startAt(url.Values{"at": {"07:29"}, "tz": {"Mars/Olympus_Mons"}}, 409)
+	w := startAt(url.Values{"at": {"2026-10-19T12:29:58.25"}, "tz": {"+00:00"}}, 200)
+	want := time.Date(2026, 10, 19, 7, 29, 58, 250000000, chicago)
+	if !race.started.Equal(want) {
+		t.Errorf("Expected the race started at %s, got %s", want, race.started)
+	}
+	if body := fmt.Sprintf("{\"started\":%q}\n", want.UTC().Format(time.RFC3339Nano)); w.Body.String() != body {
+		t.Errorf("Expected %s, got %s", body, w.Body.String())
+	}
+
+	clock.Advance(time.Minute)
+	if err := race.RecordTimeForBib("1"); err != nil {
+		t.Fatalf("Error recording bib - %v", err)
+	}
+	clock.Advance(time.Minute)
+	startAt(url.Values{"at": {"07:31:30"}, "tz": {"America/Chicago"}}, 409) // after bib 1 finished
+	startAt(url.Values{"at": {"2026-10-19T07:29:59-05:00"}}, 200)
+	race.RLock()
+	defer race.RUnlock()
+	if entry := race.bibbedEntries["1"]; time.Duration(entry.Duration) != time.Minute+time.Second {
+		t.Errorf("Expected the recorded time to follow the start, got %s", entry.Duration)
+	}
+}
+
+func TestParseTimeZone(t *testing.T) {
+	for tz, offset := range map[string]int{"": -1, "-05:00": -5 * 3600, "+0530": 5*3600 + 1800, "Z": 0, "UTC": 0} {
+		loc, err := parseTimeZone(tz)
+		if err != nil {
+			t.Errorf("%q - unexpected error %v", tz, err)
+			continue
+		}
+		if offset == -1 {
+			if loc != time.Local {
+				t.Errorf("Expected the server's time zone for a blank one, got %s", loc)
+			}
+			continue
+		}
+		if _, got := time.Date(2026, 10, 19, 0, 0, 0, 0, loc).Zone(); got != offset {
+			t.Errorf("%q - expected offset %d, got %d", tz, offset, got)
+		}
+	}
+	if _, err := parseTimeZone("soon"); err == nil {
+		t.Errorf("Expected an error for a time zone that isn't one")
+	}
+}
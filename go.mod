@@ -0,0 +1,11 @@
+module github.com/mzimmerman/racergo
+
+go 1.23.0
+
+require (
+	github.com/hashicorp/mdns v1.0.5
+	github.com/miekg/dns v1.1.65
+	github.com/skip2/go-qrcode v0.0.0-20200617195104-da1b6568686e
+	golang.org/x/image v0.25.0
+	golang.org/x/net v0.38.0
+)
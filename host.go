@@ -0,0 +1,75 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// requestScheme is how the client reached racergo
+func requestScheme(r *http.Request) string {
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// requestURL is path on the host the client used, so links work however racergo was reached
+func requestURL(r *http.Request, path string) string {
+	return requestScheme(r) + "://" + r.Host + path
+}
+
+// localURL is path on the address the request came in on, which works even when the phone has no DNS for the hostname
+func localURL(r *http.Request, path string) string {
+	if addr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+		return requestScheme(r) + "://" + addr.String() + path
+	}
+	return requestURL(r, path)
+}
+
+// hostOf is the request's host in lower case without the port
+func hostOf(r *http.Request) string {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(strings.Trim(host, "[]"))
+}
+
+// hostRouter serves app on localhost, the configured hostnames and, with acceptIPs, on any raw IP address
+// with canonicalRedirect the aliases and IPs redirect to the main hostname first
+// every other host is a phone checking for a captive portal or trying to reach the internet, it's sent to racergo
+func hostRouter(app http.Handler) http.Handler {
+	names := map[string]bool{"localhost": true}
+	var canonical string
+	for _, h := range append([]string{config.WebserverHostname}, config.Hostnames...) {
+		if host, _, err := net.SplitHostPort(h); err == nil {
+			h = host
+		}
+		h = strings.ToLower(h)
+		names[h] = true
+		if canonical == "" {
+			canonical = h
+		}
+	}
+	elsewhere := captiveHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, localURL(r, "/"), http.StatusTemporaryRedirect)
+	}))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := hostOf(r)
+		isIP := net.ParseIP(host) != nil
+		if !names[host] && !(isIP && config.AcceptIPs) {
+			elsewhere.ServeHTTP(w, r)
+			return
+		}
+		if config.CanonicalRedirect && canonical != "" && host != canonical && r.URL.Path != "/ca.crt" {
+			target := canonical
+			if _, port, err := net.SplitHostPort(r.Host); err == nil {
+				target = net.JoinHostPort(canonical, port) // same port, it's the same server
+			}
+			http.Redirect(w, r, requestScheme(r)+"://"+target+r.URL.RequestURI(), http.StatusTemporaryRedirect)
+			return
+		}
+		app.ServeHTTP(w, r)
+	})
+}
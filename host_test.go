@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHostRouter(t *testing.T) {
+	defer func(c Config) {
+		config = c
+	}(config)
+	config.WebserverHostname = "raceresults:8080"
+	config.Hostnames = []string{"results.local"}
+	config.AcceptIPs = true
+	config.CanonicalRedirect = false
+	app := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	get := func(url string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", url, nil)
+		// as if the request came in on the server's LAN address
+		r = r.WithContext(context.WithValue(r.Context(), http.LocalAddrContextKey, &net.TCPAddr{IP: net.IPv4(192, 168, 1, 10), Port: 8080}))
+		w := httptest.NewRecorder()
+		hostRouter(app).ServeHTTP(w, r)
+		return w
+	}
+	for _, url := range []string{"http://raceresults:8080/admin", "http://RaceResults/", "http://results.local/search", "http://192.168.1.10:8080/", "http://[fe80::1]/", "http://localhost:8080/"} {
+		if w := get(url); w.Code != http.StatusTeapot {
+			t.Errorf("Expected %s to be served, got %d", url, w.Code)
+		}
+	}
+	w := get("http://example.com/somewhere")
+	if location := w.Header().Get("Location"); w.Code != http.StatusTemporaryRedirect || location != "http://192.168.1.10:8080/" {
+		t.Errorf("Expected other hosts to redirect to the address racergo was reached on, got %d %s", w.Code, location)
+	}
+
+	config.AcceptIPs = false
+	if w = get("http://192.168.1.10:8080/"); w.Code != http.StatusTemporaryRedirect {
+		t.Errorf("Expected IPs not to be served without acceptIPs, got %d", w.Code)
+	}
+
+	config.AcceptIPs = true
+	config.CanonicalRedirect = true
+	if w = get("http://raceresults:8080/admin"); w.Code != http.StatusTeapot {
+		t.Errorf("Expected the canonical hostname to be served, got %d", w.Code)
+	}
+	for url, location := range map[string]string{
+		"http://results.local:8080/search?q=jane": "http://raceresults:8080/search?q=jane",
+		"http://192.168.1.10/":                    "http://raceresults/",
+	} {
+		if w = get(url); w.Code != http.StatusTemporaryRedirect || w.Header().Get("Location") != location {
+			t.Errorf("Expected %s to redirect to %s, got %d %s", url, location, w.Code, w.Header().Get("Location"))
+		}
+	}
+	if w = get("http://192.168.1.10/ca.crt"); w.Code != http.StatusTeapot {
+		t.Errorf("Expected the CA to be served on any host, got %d", w.Code)
+	}
+}
+
+func TestRequestURL(t *testing.T) {
+	r := httptest.NewRequest("GET", "http://192.168.1.10:8080/results", nil)
+	if got := runnerURL(r, "7"); got != "http://192.168.1.10:8080/runner/7" {
+		t.Errorf("Expected the runner url on the host the request used, got %s", got)
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+
+	qrcode "github.com/skip2/go-qrcode"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+const (
+	labelWidth  = 800
+	labelHeight = 300
+	labelQRSize = 280
+)
+
+// BibLabel is a printable bib, the QR code encodes only the bib # so the scanner page can link it directly
+type BibLabel struct {
+	Bib   Bib
+	Fname string
+	Lname string
+	QR    template.URL // data uri of the QR code png
+}
+
+// BibLabels returns the labels for all bibbed entries from low to high inclusive, ordered by bib
+func (s *RaceSnapshot) BibLabels(low, high Bib) ([]BibLabel, error) {
+	labels := make([]BibLabel, 0, len(s.Bibbed))
+	for bib, entry := range s.Bibbed {
+		if (low != NoBib && bib.Compare(low) < 0) || (high != NoBib && bib.Compare(high) > 0) {
+			continue
+		}
+		qr, err := qrcode.Encode(bib.String(), qrcode.Medium, 128)
+		if err != nil {
+			return nil, err
+		}
+		labels = append(labels, BibLabel{
+			Bib:   bib,
+			Fname: entry.Fname,
+			Lname: entry.Lname,
+			QR:    template.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(qr)),
+		})
+	}
+	sort.Slice(labels, func(i, j int) bool {
+		return labels[i].Bib.Compare(labels[j].Bib) < 0
+	})
+	return labels, nil
+}
+
+// bibRange reads the optional from and to form values, NoBib for either means that end is open
+func bibRange(r *http.Request) (Bib, Bib, error) {
+	low, err := ParseBib(r.FormValue("from"))
+	if err != nil {
+		return low, NoBib, fmt.Errorf("Error %v getting from bib", err)
+	}
+	high, err := ParseBib(r.FormValue("to"))
+	if err != nil {
+		return low, high, fmt.Errorf("Error %v getting to bib", err)
+	}
+	if low != NoBib && high != NoBib && low.Compare(high) > 0 {
+		return low, high, fmt.Errorf("Bib range %s to %s is empty", low, high)
+	}
+	return low, high, nil
+}
+
+// bibLabelPNG draws a single label with the QR code on the left and the bib # and name on the right
+func bibLabelPNG(bib Bib, fname, lname string) ([]byte, error) {
+	qr, err := qrcode.New(bib.String(), qrcode.Medium)
+	if err != nil {
+		return nil, err
+	}
+	label := image.NewRGBA(image.Rect(0, 0, labelWidth, labelHeight))
+	draw.Draw(label, label.Bounds(), image.White, image.Point{}, draw.Src)
+	qrTop := (labelHeight - labelQRSize) / 2
+	draw.Draw(label, image.Rect(10, qrTop, 10+labelQRSize, qrTop+labelQRSize), qr.Image(labelQRSize), image.Point{}, draw.Src)
+	drawScaledText(label, 20+labelQRSize, 30, bib.String(), 12)
+	drawScaledText(label, 20+labelQRSize, 200, strings.TrimSpace(fname+" "+lname), 3)
+	buf := &bytes.Buffer{}
+	err = png.Encode(buf, label)
+	return buf.Bytes(), err
+}
+
+// drawScaledText draws text with the built in bitmap font, blown up by scale so it's readable from a distance
+func drawScaledText(dst *image.RGBA, x, y int, text string, scale int) {
+	face := basicfont.Face7x13
+	width := font.MeasureString(face, text).Ceil()
+	if maxWidth := (dst.Bounds().Dx() - x) / scale; width > maxWidth {
+		width = maxWidth // anything past the edge of the label is clipped
+	}
+	small := image.NewAlpha(image.Rect(0, 0, width, face.Height))
+	drawer := font.Drawer{
+		Dst:  small,
+		Src:  image.Opaque,
+		Face: face,
+		Dot:  fixed.P(0, face.Ascent),
+	}
+	drawer.DrawString(text)
+	for sy := 0; sy < small.Bounds().Dy(); sy++ {
+		for sx := 0; sx < small.Bounds().Dx(); sx++ {
+			if small.AlphaAt(sx, sy).A == 0 {
+				continue
+			}
+			draw.Draw(dst, image.Rect(x+sx*scale, y+sy*scale, x+(sx+1)*scale, y+(sy+1)*scale), image.NewUniform(color.Black), image.Point{}, draw.Src)
+		}
+	}
+}
+
+// bibLabelsHandler serves /bibs as a printable page of labels and /bibs/{bib}.png as a single label image
+func bibLabelsHandler(w http.ResponseWriter, r *http.Request, race *Race) {
+	name := strings.TrimPrefix(r.URL.Path, "/bibs/")
+	if name == r.URL.Path || name == "" {
+		if _, _, err := bibRange(r); err != nil {
+			showErrorForAdmin(w, r.Referer(), "%v", err)
+			return
+		}
+		handler(w, r, race)
+		return
+	}
+	bib, err := ParseBib(strings.TrimSuffix(name, ".png"))
+	if err != nil || bib == NoBib || !strings.HasSuffix(name, ".png") {
+		http.NotFound(w, r)
+		return
+	}
+	entry, ok := race.Snapshot().Bibbed[bib]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	label, err := bibLabelPNG(bib, entry.Fname, entry.Lname)
+	if err != nil {
+		w.WriteHeader(500)
+		fmt.Fprintf(w, "Error generating bib label - %v", err)
+		slog.Error("Error generating bib label", "err", err)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=\"bib-%s.png\"", bib))
+	w.Write(label)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// newLogHandler is the handler for racergo's own log, logfmt (text) or json at the configured level
+func newLogHandler(w io.Writer, format, level string) (slog.Handler, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("logLevel %q must be debug, info, warn or error", level)
+	}
+	opts := &slog.HandlerOptions{Level: lvl}
+	switch strings.ToLower(format) {
+	case "text", "logfmt":
+		return slog.NewTextHandler(w, opts), nil
+	case "json":
+		return slog.NewJSONHandler(w, opts), nil
+	}
+	return nil, fmt.Errorf("logFormat %q must be text or json", format)
+}
+
+// setupLogging sends racergo's log, and anything still using the log package, to stderr as configured
+func setupLogging(c Config) error {
+	h, err := newLogHandler(os.Stderr, c.LogFormat, c.LogLevel)
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(slog.New(h))
+	return nil
+}
+
+// fatal logs an error that racergo can't run with and exits
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+// openEventLog opens the race's event log for appending, every change to the race is a JSON line in it with when it
+// happened and who did it, it's never rewritten so it still has everything if the race has to be pieced back together
+func openEventLog(filename string) (*slog.Logger, io.Closer, error) {
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, nil, err
+	}
+	return slog.New(slog.NewJSONHandler(f, nil)), f, nil
+}
+
+// actorOf is who made a request for the event log, the shared tokens don't say which person it was so the role and
+// the address they were on will have to do
+func actorOf(r *http.Request) string {
+	return actor(requestRole(r), r)
+}
+
+func actor(role Role, r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return role.String() + "@" + host
+}
+
+// raceEvent records a change to the race in the event log, it does nothing if there isn't one
+func (race *Race) raceEvent(actor, event string, args ...any) {
+	if race.eventLog == nil {
+		return
+	}
+	race.eventLog.Info(event, append([]any{"actor", actor}, args...)...)
+}
+
+// durationOf is the bib's time as of now, for the event log
+func (race *Race) durationOf(bib Bib) HumanDuration {
+	race.RLock()
+	defer race.RUnlock()
+	if entry, ok := race.bibbedEntries[bib]; ok {
+		return entry.Duration
+	}
+	return 0
+}
+
+// LogValue logs durations the way the race shows them, 0:18:03.12, rather than as nanoseconds
+func (hd HumanDuration) LogValue() slog.Value {
+	return slog.StringValue(hd.String())
+}
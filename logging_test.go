@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewLogHandler(t *testing.T) {
+	for _, test := range []struct {
+		format, level string
+		ok            bool
+	}{
+		{"text", "info", true},
+		{"logfmt", "DEBUG", true},
+		{"json", "warn", true},
+		{"xml", "info", false},
+		{"text", "loud", false},
+	} {
+		if _, err := newLogHandler(&bytes.Buffer{}, test.format, test.level); (err == nil) != test.ok {
+			t.Errorf("%s %s - expected ok %t, got %v", test.format, test.level, test.ok, err)
+		}
+	}
+	buf := &bytes.Buffer{}
+	h, _ := newLogHandler(buf, "json", "info")
+	logger := slog.New(h)
+	logger.Debug("Race clock", "time", HumanDuration(time.Minute))
+	logger.Info("Bib linked", "bib", Bib("12"), "duration", HumanDuration(time.Minute))
+	if strings.Contains(buf.String(), "Race clock") {
+		t.Errorf("Expected debug messages to be left out at info, got %s", buf.String())
+	}
+	if !strings.Contains(buf.String(), `"msg":"Bib linked","bib":"12","duration":"00:01:00.00"`) {
+		t.Errorf("Expected the link as JSON with a readable duration, got %s", buf.String())
+	}
+}
+
+func TestRaceEventLog(t *testing.T) {
+	clock := NewManualClock(time.Now())
+	race := NewRaceWithClock(clock)
+	if err := race.AddEntry(Entry{Bib: "12", Fname: "Sarah", Lname: "Smith", Age: 28}); err != nil {
+		t.Fatalf("Error adding entry - %v", err)
+	}
+	filename := filepath.Join(t.TempDir(), "race-events.log")
+	if err := os.WriteFile(filename, []byte(`{"msg":"from before a restart"}`+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	eventLog, f, err := openEventLog(filename)
+	if err != nil {
+		t.Fatalf("Error opening the event log - %v", err)
+	}
+	race.eventLog = eventLog
+	post := func(h RaceHandler, form url.Values) {
+		r := httptest.NewRequest("POST", "/", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		h(w, r, race)
+		if w.Code != 301 {
+			t.Fatalf("Expected a redirect, got %d - %s", w.Code, w.Body.String())
+		}
+	}
+	post(startHandler, nil)
+	clock.Advance(time.Minute)
+	post(linkBibHandler, url.Values{"bib": {"12"}, "scanned": {"true"}})
+	f.Close()
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := bufio.NewScanner(bytes.NewReader(data))
+	var events []map[string]interface{}
+	for lines.Scan() {
+		var event map[string]interface{}
+		if err := json.Unmarshal(lines.Bytes(), &event); err != nil {
+			t.Fatalf("Expected a JSON line, got %s - %v", lines.Text(), err)
+		}
+		events = append(events, event)
+	}
+	if len(events) != 4 || events[0]["msg"] != "from before a restart" {
+		t.Fatalf("Expected 3 events appended to the existing log, got %s", data)
+	}
+	for x, want := range []map[string]interface{}{
+		{"msg": "start", "actor": "public@192.0.2.1"},
+		{"msg": "link", "actor": "public@192.0.2.1", "bib": "12", "duration": "00:01:00.00"},
+		{"msg": "confirm", "actor": "public@192.0.2.1", "bib": "12", "duration": "00:01:00.00"},
+	} {
+		event := events[x+1]
+		if _, ok := event["time"]; !ok {
+			t.Errorf("Expected the %s event to have a time", want["msg"])
+		}
+		for key, val := range want {
+			if event[key] != val {
+				t.Errorf("Expected %s %v in the %s event, got %v", key, val, want["msg"], event[key])
+			}
+		}
+	}
+}
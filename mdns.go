@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+
+	"github.com/hashicorp/mdns"
+	"github.com/miekg/dns"
+)
+
+const mdnsMaxLabel = 63 // longest a service instance name can be
+
+// mdnsPages are advertised as their own DNS-SD services so they show up by name on the LAN
+var mdnsPages = []struct {
+	name string
+	path string
+}{
+	{"Results", "/results"},
+	{"Admin", "/admin"},
+	{"Scanner", "/scanner"},
+}
+
+// mdnsZone answers for every advertised service, records the services share like the host's address are only given once
+type mdnsZone []mdns.Zone
+
+func (z mdnsZone) Records(q dns.Question) []dns.RR {
+	var rrs []dns.RR
+	seen := make(map[string]bool)
+	for _, zone := range z {
+		for _, rr := range zone.Records(q) {
+			if !seen[rr.String()] {
+				seen[rr.String()] = true
+				rrs = append(rrs, rr)
+			}
+		}
+	}
+	return rrs
+}
+
+// mdnsHostname is the .local name racergo is advertised at
+func mdnsHostname() string {
+	name := "racergo"
+	if names := config.HostNames(); len(names) > 0 && names[0] != "localhost" {
+		name = names[0]
+	}
+	return strings.TrimSuffix(name, ".local") + ".local."
+}
+
+// mdnsServices builds a _http._tcp service for each page, all on hostname
+func mdnsServices(hostname string, port int, ips []net.IP) (mdnsZone, error) {
+	raceName := strings.ReplaceAll(config.RaceName, ".", "")
+	var zone mdnsZone
+	for _, page := range mdnsPages {
+		suffix := " " + page.name
+		instance := raceName
+		if room := mdnsMaxLabel - len(suffix); len(instance) > room {
+			instance = strings.TrimSpace(strings.ToValidUTF8(instance[:room], ""))
+		}
+		service, err := mdns.NewMDNSService(instance+suffix, "_http._tcp", "local.", hostname, port, ips, []string{"path=" + page.path})
+		if err != nil {
+			return nil, err
+		}
+		zone = append(zone, service)
+	}
+	return zone, nil
+}
+
+// advertiseMDNS makes racergo reachable as <hostname>.local and browsable with DNS-SD, it's best effort as
+// not every network allows multicast
+func advertiseMDNS(port int) {
+	var ips []net.IP
+	for _, ip := range lanIPs() {
+		if !ip.IsLoopback() {
+			ips = append(ips, ip)
+		}
+	}
+	if len(ips) == 0 {
+		slog.Warn("No LAN addresses to advertise with mDNS")
+		return
+	}
+	hostname := mdnsHostname()
+	zone, err := mdnsServices(hostname, port, ips)
+	if err != nil {
+		slog.Error("Error creating mDNS services", "err", err)
+		return
+	}
+	if _, err = mdns.NewServer(&mdns.Config{Zone: zone}); err != nil {
+		slog.Error("Error advertising with mDNS", "err", err)
+		return
+	}
+	slog.Info("Advertising with mDNS", "url", fmt.Sprintf("http://%s:%d", strings.TrimSuffix(hostname, "."), port))
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestMDNSServices(t *testing.T) {
+	defer func(hostname string) {
+		config.WebserverHostname = hostname
+	}(config.WebserverHostname)
+	config.WebserverHostname = "CampusLife5k:8080"
+	hostname := mdnsHostname()
+	if hostname != "campuslife5k.local." {
+		t.Errorf("Expected the hostname without the port under .local, got %s", hostname)
+	}
+	config.WebserverHostname = "localhost:8080"
+	if got := mdnsHostname(); got != "racergo.local." {
+		t.Errorf("Expected localhost to be advertised as racergo, got %s", got)
+	}
+
+	defer func(raceName string) {
+		config.RaceName = raceName
+	}(config.RaceName)
+	config.RaceName = "The 2024 Campus Life 5k Orchard Run and Family Fun Walk, Sponsored by Everyone"
+	zone, err := mdnsServices(hostname, 8080, []net.IP{net.IPv4(192, 168, 1, 10)})
+	if err != nil {
+		t.Fatalf("Error creating services - %v", err)
+	}
+	// answers include the records a browser needs next, only look at the type that was asked for
+	records := func(name string, qtype uint16) []dns.RR {
+		var rrs []dns.RR
+		for _, rr := range zone.Records(dns.Question{Name: name, Qtype: qtype, Qclass: dns.ClassINET}) {
+			if rr.Header().Rrtype == qtype && rr.Header().Name == name {
+				rrs = append(rrs, rr)
+			}
+		}
+		return rrs
+	}
+	ptrs := records("_http._tcp.local.", dns.TypePTR)
+	if len(ptrs) != len(mdnsPages) {
+		t.Fatalf("Expected a service for each page, got %v", ptrs)
+	}
+	for x, page := range mdnsPages {
+		instance := ptrs[x].(*dns.PTR).Ptr
+		if !strings.Contains(instance, page.name) {
+			t.Errorf("Expected the %s service, got %s", page.name, instance)
+		}
+		if label := dns.SplitDomainName(instance)[0]; len(label) > mdnsMaxLabel {
+			t.Errorf("Expected the instance name to be shortened to fit a DNS label, got %s", label)
+		}
+		txt := records(instance, dns.TypeTXT)
+		if len(txt) != 1 || txt[0].(*dns.TXT).Txt[0] != "path="+page.path {
+			t.Errorf("Expected %s to have path %s, got %v", page.name, page.path, txt)
+		}
+	}
+	a := records(hostname, dns.TypeA)
+	if len(a) != 1 || a[0].(*dns.A).A.String() != "192.168.1.10" {
+		t.Errorf("Expected one address for the hostname, got %v", a)
+	}
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"runtime"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// latencyBuckets are the upper bounds, in seconds, of every histogram's buckets
+var latencyBuckets = [...]float64{.0001, .0005, .001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// histogram counts durations into latencyBuckets the way Prometheus expects, the zero value is ready to use
+type histogram struct {
+	counts [len(latencyBuckets) + 1]atomic.Uint64 // the last is +Inf
+	count  atomic.Uint64
+	sum    atomic.Int64 // nanoseconds
+}
+
+func (h *histogram) Observe(d time.Duration) {
+	seconds := d.Seconds()
+	bucket := sort.SearchFloat64s(latencyBuckets[:], seconds)
+	h.counts[bucket].Add(1)
+	h.count.Add(1)
+	h.sum.Add(int64(d))
+}
+
+// write prints the histogram's series, labels is what goes between the braces, e.g. handler="/linkBib"
+func (h *histogram) write(w io.Writer, name, labels string) {
+	sep := ""
+	if labels != "" {
+		sep = ","
+	}
+	var cumulative uint64
+	for x, le := range latencyBuckets {
+		cumulative += h.counts[x].Load()
+		fmt.Fprintf(w, "%s_bucket{%s%sle=\"%s\"} %d\n", name, labels, sep, strconv.FormatFloat(le, 'g', -1, 64), cumulative)
+	}
+	cumulative += h.counts[len(latencyBuckets)].Load()
+	fmt.Fprintf(w, "%s_bucket{%s%sle=\"+Inf\"} %d\n", name, labels, sep, cumulative)
+	if labels != "" {
+		labels = "{" + labels + "}"
+	}
+	fmt.Fprintf(w, "%s_sum%s %g\n", name, labels, time.Duration(h.sum.Load()).Seconds())
+	fmt.Fprintf(w, "%s_count%s %d\n", name, labels, h.count.Load())
+}
+
+// rateCounter counts events and how many of them were in the last minute
+type rateCounter struct {
+	sync.Mutex
+	total  uint64
+	recent []time.Time
+}
+
+func (rc *rateCounter) Add(now time.Time) {
+	rc.Lock()
+	defer rc.Unlock()
+	rc.total++
+	rc.recent = append(rc.prune(now), now)
+}
+
+// PerMinute is how many events there were in the minute before now, and how many there have been in all
+func (rc *rateCounter) PerMinute(now time.Time) (int, uint64) {
+	rc.Lock()
+	defer rc.Unlock()
+	rc.recent = rc.prune(now)
+	return len(rc.recent), rc.total
+}
+
+func (rc *rateCounter) prune(now time.Time) []time.Time {
+	x := sort.Search(len(rc.recent), func(i int) bool {
+		return now.Sub(rc.recent[i]) < time.Minute
+	})
+	return append(rc.recent[:0], rc.recent[x:]...)
+}
+
+// handlerLatency is each route's histogram, added by handle as the routes are registered
+var handlerLatency struct {
+	sync.Mutex
+	routes map[string]*histogram
+}
+
+// handle registers h for pattern the same as http.Handle, timing every request for /metrics
+func handle(pattern string, h http.Handler) {
+	handlerLatency.Lock()
+	if handlerLatency.routes == nil {
+		handlerLatency.routes = make(map[string]*histogram)
+	}
+	latency, ok := handlerLatency.routes[pattern]
+	if !ok {
+		latency = &histogram{}
+		handlerLatency.routes[pattern] = latency
+	}
+	handlerLatency.Unlock()
+	http.Handle(pattern, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		h.ServeHTTP(w, r)
+		latency.Observe(time.Since(start))
+	}))
+}
+
+// lockProbe checks the race can be locked, one goroutine at a time, if the lock is stuck every check waits on the
+// same one rather than piling up another reader behind it each time
+type lockProbe struct {
+	sync.Mutex
+	done chan struct{} // closed once the probe gets the lock, nil when there's no probe waiting
+}
+
+func (p *lockProbe) probe(race *Race) <-chan struct{} {
+	p.Lock()
+	defer p.Unlock()
+	if p.done == nil {
+		done := make(chan struct{})
+		p.done = done
+		go func() {
+			race.RLock()
+			race.RUnlock()
+			p.Lock()
+			p.done = nil
+			p.Unlock()
+			close(done)
+		}()
+	}
+	return p.done
+}
+
+// healthzHandler answers 200 as long as the race can be locked, a stuck lock means nothing can be recorded
+func healthzHandler(w http.ResponseWriter, r *http.Request, race *Race) {
+	locked := race.health.probe(race)
+	w.Header().Set("Cache-Control", "no-cache")
+	select {
+	case <-locked:
+		fmt.Fprintln(w, "ok")
+	case <-time.After(healthzTimeout):
+		http.Error(w, "race is locked", http.StatusServiceUnavailable)
+	}
+}
+
+var healthzTimeout = 2 * time.Second // a var so the tests don't have to wait this long
+
+// metricsHandler serves the race and server's metrics in Prometheus' text format
+func metricsHandler(w http.ResponseWriter, r *http.Request, race *Race) {
+	snap := race.Snapshot()
+	now := race.GetTime()
+	var finished, confirmed int
+	for _, entry := range snap.Entries {
+		if entry.HasFinished() {
+			finished++
+			if entry.Confirmed {
+				confirmed++
+			}
+		}
+	}
+	linksPerMinute, links := race.links.PerMinute(now)
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	gauge := func(name, help string, val interface{}) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %v\n", name, help, name, name, val)
+	}
+	counter := func(name, help string, val interface{}) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n%s %v\n", name, help, name, name, val)
+	}
+	gauge("racergo_entries", "Entries loaded, bibbed or not.", len(snap.Entries))
+	gauge("racergo_finishers", "Entries with a finish time.", finished)
+	gauge("racergo_confirmed", "Finishers whose time has been confirmed.", confirmed)
+	gauge("racergo_unconfirmed", "Finishers waiting to be confirmed.", finished-confirmed)
+	started, elapsed := 0, 0.0
+	if !snap.Started.IsZero() {
+		started, elapsed = 1, now.Sub(snap.Started).Seconds()
+	}
+	gauge("racergo_race_started", "1 once the race has started.", started)
+	gauge("racergo_race_elapsed_seconds", "Time on the race clock.", elapsed)
+	gauge("racergo_race_version", "Changes made to the race since racergo started.", snap.Version)
+	counter("racergo_links_total", "Bibs linked to a finish time.", links)
+	gauge("racergo_links_per_minute", "Bibs linked to a finish time in the last minute.", linksPerMinute)
+	gauge("racergo_email_queue_depth", "Results e-mails waiting to go out.", emails.depth.Load())
+	counter("racergo_emails_sent_total", "Results e-mails sent.", emails.sent.Load())
+	counter("racergo_email_failures_total", "Attempts to send a results e-mail that failed and will be retried.", emails.failures.Load())
+
+	fmt.Fprintf(w, "# HELP racergo_lock_wait_seconds Time spent waiting for the race's lock.\n# TYPE racergo_lock_wait_seconds histogram\n")
+	race.writeWait.write(w, "racergo_lock_wait_seconds", `mode="write"`)
+	race.readWait.write(w, "racergo_lock_wait_seconds", `mode="read"`)
+
+	fmt.Fprintf(w, "# HELP racergo_request_duration_seconds Time to handle a request, by route.\n# TYPE racergo_request_duration_seconds histogram\n")
+	handlerLatency.Lock()
+	routes := make([]string, 0, len(handlerLatency.routes))
+	for route := range handlerLatency.routes {
+		routes = append(routes, route)
+	}
+	sort.Strings(routes)
+	for _, route := range routes {
+		handlerLatency.routes[route].write(w, "racergo_request_duration_seconds", fmt.Sprintf("handler=%q", route))
+	}
+	handlerLatency.Unlock()
+
+	stats := queueStats()
+	classes := make([]string, 0, len(stats))
+	for class := range stats {
+		classes = append(classes, class)
+	}
+	sort.Strings(classes)
+	for _, series := range []struct {
+		name, help, kind string
+		val              func(QueueStats) interface{}
+	}{
+		{"racergo_requests_active", "Requests being handled, by class.", "gauge", func(s QueueStats) interface{} { return s.Active }},
+		{"racergo_requests_waiting", "Requests queued for a turn, by class.", "gauge", func(s QueueStats) interface{} { return s.Waiting }},
+		{"racergo_requests_served_total", "Requests handled, by class.", "counter", func(s QueueStats) interface{} { return s.Served }},
+		{"racergo_requests_shed_total", "Requests turned away with a 503, by class.", "counter", func(s QueueStats) interface{} { return s.Shed }},
+	} {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", series.name, series.help, series.name, series.kind)
+		for _, class := range classes {
+			fmt.Fprintf(w, "%s{class=%q} %v\n", series.name, class, series.val(stats[class]))
+		}
+	}
+	gauge("go_goroutines", "Number of goroutines that currently exist.", runtime.NumGoroutine())
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHistogram(t *testing.T) {
+	var h histogram
+	for _, d := range []time.Duration{50 * time.Microsecond, time.Millisecond, 3 * time.Millisecond, time.Minute} {
+		h.Observe(d)
+	}
+	buf := &bytes.Buffer{}
+	h.write(buf, "wait_seconds", `mode="write"`)
+	for _, want := range []string{
+		`wait_seconds_bucket{mode="write",le="0.0001"} 1`,
+		`wait_seconds_bucket{mode="write",le="0.001"} 2`, // the bounds include the value
+		`wait_seconds_bucket{mode="write",le="0.005"} 3`,
+		`wait_seconds_bucket{mode="write",le="10"} 3`,
+		`wait_seconds_bucket{mode="write",le="+Inf"} 4`,
+		`wait_seconds_sum{mode="write"} 60.00405`,
+		`wait_seconds_count{mode="write"} 4`,
+	} {
+		if !strings.Contains(buf.String(), want+"\n") {
+			t.Errorf("Expected %s, got\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestRateCounter(t *testing.T) {
+	var rc rateCounter
+	now := time.Now()
+	for x := 0; x < 5; x++ {
+		rc.Add(now.Add(time.Duration(x) * 20 * time.Second))
+	}
+	if perMinute, total := rc.PerMinute(now.Add(90 * time.Second)); perMinute != 3 || total != 5 {
+		t.Errorf("Expected 3 in the last minute of 5, got %d of %d", perMinute, total)
+	}
+	if perMinute, total := rc.PerMinute(now.Add(time.Hour)); perMinute != 0 || total != 5 {
+		t.Errorf("Expected none in the last minute of 5, got %d of %d", perMinute, total)
+	}
+}
+
+func TestHealthz(t *testing.T) {
+	defer func(timeout time.Duration) {
+		healthzTimeout = timeout
+	}(healthzTimeout)
+	healthzTimeout = 50 * time.Millisecond
+	race := NewRace()
+	w := httptest.NewRecorder()
+	healthzHandler(w, httptest.NewRequest("GET", "/healthz", nil), race)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected healthy, got %d", w.Code)
+	}
+	race.Lock()
+	for x := 0; x < 3; x++ {
+		w = httptest.NewRecorder()
+		healthzHandler(w, httptest.NewRequest("GET", "/healthz", nil), race)
+		if w.Code != http.StatusServiceUnavailable {
+			t.Errorf("Expected unhealthy while the race is stuck locked, got %d", w.Code)
+		}
+	}
+	waiting := race.health.probe(race)
+	if again := race.health.probe(race); again != waiting {
+		t.Errorf("Expected every check to wait on the same probe while the lock is stuck")
+	}
+	race.Unlock()
+	<-waiting
+	w = httptest.NewRecorder()
+	healthzHandler(w, httptest.NewRequest("GET", "/healthz", nil), race)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected healthy once the lock is free, got %d", w.Code)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	clock := NewManualClock(time.Now())
+	race := NewRaceWithClock(clock)
+	for _, e := range []Entry{
+		{Bib: "1", Fname: "Matthew", Lname: "Zimmerman", Age: 34, Male: true},
+		{Bib: "2", Fname: "Sarah", Lname: "Smith", Age: 28},
+		{Bib: "3", Fname: "Adam", Lname: "Anderson", Age: 61, Male: true},
+	} {
+		if err := race.AddEntry(e); err != nil {
+			t.Fatalf("Error adding entry - %v", err)
+		}
+	}
+	startRace(race)
+	clock.Advance(time.Minute)
+	linkBibTesting(t, race, "1", false, true)
+	linkBibTesting(t, race, "2", false, false)
+	w := httptest.NewRecorder()
+	metricsHandler(w, httptest.NewRequest("GET", "/metrics", nil), race)
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Expected the Prometheus text format, got %s", ct)
+	}
+	for _, want := range []string{
+		"# TYPE racergo_entries gauge\nracergo_entries 3\n",
+		"racergo_finishers 2\n",
+		"racergo_confirmed 1\n",
+		"racergo_unconfirmed 1\n",
+		"racergo_race_started 1\n",
+		"# TYPE racergo_links_total counter\nracergo_links_total 2\n",
+		"racergo_links_per_minute 2\n",
+		"racergo_email_queue_depth ",
+		"# TYPE racergo_lock_wait_seconds histogram\n",
+		`racergo_lock_wait_seconds_count{mode="write"} `,
+		`racergo_lock_wait_seconds_count{mode="read"} `,
+	} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Errorf("Expected %q in\n%s", want, w.Body.String())
+		}
+	}
+	if race.writeWait.count.Load() == 0 {
+		t.Errorf("Expected the race's changes to have timed the lock")
+	}
+}
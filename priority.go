@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// RequestClass is who a request is for, each class has its own limit and queue so a crowd of spectators refreshing
+// the results can't hold up the timers at the finish line
+type RequestClass int
+
+const (
+	ClassFinish RequestClass = iota // timers and admins recording, confirming and fixing results
+	ClassStaff                      // the rest of what staff do, admin pages, registration, downloads
+	ClassPublic                     // spectators
+	numClasses
+)
+
+var requestClassNames = [numClasses]string{"finish", "staff", "public"}
+
+func (c RequestClass) String() string {
+	return requestClassNames[c]
+}
+
+const (
+	publicWait       = 3 * time.Second // longest a spectator's request waits for a turn before it's turned away
+	publicRetryAfter = 5 * time.Second // when they're told to try again
+)
+
+// unlimitedPaths don't do any work against the race, or in the case of /events hold their connection open for as
+// long as the page is, so they'd only ever block the requests that do, monitoring needs to get through when it's busy
+var unlimitedPaths = []string{"/events", "/static/", "/fonts/", "/ca.crt", "/healthz", "/metrics"}
+
+// classify sorts a request into its class by the session's role, the scanner page is where finishes are recorded
+func classify(r *http.Request) RequestClass {
+	role := cookieSession(r).role
+	switch {
+	case role == RolePublic:
+		return ClassPublic
+	case role.Allows(RoleTimer) && (r.Method == "POST" || r.URL.Path == "/scanner"):
+		return ClassFinish
+	}
+	return ClassStaff
+}
+
+// limiter lets a class's requests in a few at a time, the rest queue in arrival order
+type limiter struct {
+	slots   chan struct{}
+	queue   int           // most requests waiting for a slot before more are turned away, 0 for no limit
+	wait    time.Duration // longest a request waits for a slot, 0 for as long as the client does
+	active  atomic.Int64
+	waiting atomic.Int64
+	served  atomic.Uint64
+	shed    atomic.Uint64
+}
+
+func newLimiter(slots, queue int, wait time.Duration) *limiter {
+	return &limiter{slots: make(chan struct{}, max(slots, 1)), queue: queue, wait: wait}
+}
+
+// acquire waits for a slot, false if the request was turned away or gave up waiting
+func (l *limiter) acquire(ctx context.Context) bool {
+	select {
+	case l.slots <- struct{}{}:
+		l.active.Add(1)
+		return true
+	default:
+	}
+	if waiting := l.waiting.Add(1); l.queue > 0 && waiting > int64(l.queue) {
+		l.waiting.Add(-1)
+		l.shed.Add(1)
+		return false
+	}
+	defer l.waiting.Add(-1)
+	var timeout <-chan time.Time
+	if l.wait > 0 {
+		timer := time.NewTimer(l.wait)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case l.slots <- struct{}{}:
+		l.active.Add(1)
+		return true
+	case <-timeout:
+		l.shed.Add(1)
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (l *limiter) release() {
+	l.served.Add(1)
+	l.active.Add(-1)
+	<-l.slots
+}
+
+// requestLimits are the limiters prioritize set up, for queuesHandler
+var requestLimits [numClasses]*limiter
+
+// defaultPublicRequests leaves a cpu free of spectators so there's always one to record finishes on
+func defaultPublicRequests() int {
+	return max(runtime.NumCPU()-1, 1)
+}
+
+// prioritize runs requests through their class's limiter, the finish line gets as many slots as there are cpus and
+// is never turned away, staff the same but separately, spectators get config.PublicRequests at a time with
+// config.PublicQueue waiting and are told to come back with a 503 past that
+func prioritize(h http.Handler) http.Handler {
+	public := config.PublicRequests
+	if public <= 0 {
+		public = defaultPublicRequests()
+	}
+	queue := config.PublicQueue
+	if queue <= 0 {
+		queue = 4 * public
+	}
+	requestLimits = [numClasses]*limiter{
+		ClassFinish: newLimiter(runtime.NumCPU(), 0, 0),
+		ClassStaff:  newLimiter(runtime.NumCPU(), 0, 0),
+		ClassPublic: newLimiter(public, queue, publicWait),
+	}
+	limits := requestLimits
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, path := range unlimitedPaths {
+			if r.URL.Path == path || (strings.HasSuffix(path, "/") && strings.HasPrefix(r.URL.Path, path)) {
+				h.ServeHTTP(w, r)
+				return
+			}
+		}
+		l := limits[classify(r)]
+		if !l.acquire(r.Context()) {
+			w.Header().Set("Retry-After", strconv.Itoa(int(publicRetryAfter.Seconds())))
+			http.Error(w, "racergo is busy, try again in a few seconds", http.StatusServiceUnavailable)
+			return
+		}
+		defer l.release()
+		h.ServeHTTP(w, r)
+	})
+}
+
+// QueueStats is how busy a class of requests is
+type QueueStats struct {
+	Limit   int    `json:"limit"`   // requests handled at once
+	Active  int64  `json:"active"`  // being handled now
+	Waiting int64  `json:"waiting"` // queued for a slot
+	Served  uint64 `json:"served"`  // handled since racergo started
+	Shed    uint64 `json:"shed"`    // turned away with a 503
+}
+
+func queueStats() map[string]QueueStats {
+	stats := make(map[string]QueueStats, numClasses)
+	for class, l := range requestLimits {
+		if l == nil {
+			continue
+		}
+		stats[RequestClass(class).String()] = QueueStats{
+			Limit:   cap(l.slots),
+			Active:  l.active.Load(),
+			Waiting: l.waiting.Load(),
+			Served:  l.served.Load(),
+			Shed:    l.shed.Load(),
+		}
+	}
+	return stats
+}
+
+// queuesHandler shows admins how deep each class's queue is and how many spectators have been turned away
+func queuesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	json.NewEncoder(w).Encode(queueStats())
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestClassify(t *testing.T) {
+	config.TimerToken = "timersecret"
+	config.RegistrationToken = "registrationsecret"
+	defer func() {
+		config.TimerToken = ""
+		config.RegistrationToken = ""
+	}()
+	admin := login(t, config.AdminToken)
+	timer := login(t, "timersecret")
+	registration := login(t, "registrationsecret")
+	tests := []struct {
+		method string
+		path   string
+		cookie *http.Cookie
+		class  RequestClass
+	}{
+		{"GET", "/", nil, ClassPublic},
+		{"POST", "/linkBib", nil, ClassPublic}, // not logged in, it'll be forbidden anyway
+		{"POST", "/linkBib", timer, ClassFinish},
+		{"GET", "/scanner", timer, ClassFinish},
+		{"POST", "/modifyEntry", admin, ClassFinish},
+		{"GET", "/admin", admin, ClassStaff},
+		{"GET", "/results", timer, ClassStaff},
+		{"POST", "/addEntry", registration, ClassStaff},
+	}
+	for _, test := range tests {
+		r, _ := http.NewRequest(test.method, test.path, nil)
+		if test.cookie != nil {
+			r.AddCookie(test.cookie)
+		}
+		if class := classify(r); class != test.class {
+			t.Errorf("%s %s - expected %s, got %s", test.method, test.path, test.class, class)
+		}
+	}
+}
+
+func TestPrioritize(t *testing.T) {
+	defer func(c Config) {
+		config = c
+	}(config)
+	config.TimerToken = "timersecret"
+	config.PublicRequests = 1
+	config.PublicQueue = 1
+	timer := login(t, "timersecret")
+	unblock := make(chan struct{})
+	started := make(chan struct{}, 10)
+	h := prioritize(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			started <- struct{}{}
+			<-unblock
+		}
+		w.Write([]byte("ok"))
+	}))
+	serve := func(method, path string, cookie *http.Cookie) *httptest.ResponseRecorder {
+		r, _ := http.NewRequest(method, path, nil)
+		if cookie != nil {
+			r.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+	done := make(chan int, 2)
+	for x := 0; x < 2; x++ {
+		go func() {
+			done <- serve("GET", "/slow", nil).Code
+		}()
+	}
+	<-started // one spectator has the only public slot, the other is queued behind it
+	for deadline := time.Now().Add(5 * time.Second); requestLimits[ClassPublic].waiting.Load() != 1; {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected a spectator waiting")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	w := serve("GET", "/results", nil)
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") == "" {
+		t.Errorf("Expected spectators past the queue to be told to retry, got %d", w.Code)
+	}
+	if w := serve("POST", "/linkBib", timer); w.Code != http.StatusOK {
+		t.Errorf("Expected the timer not to wait behind spectators, got %d", w.Code)
+	}
+	if w := serve("GET", "/static/bootstrap.min.css", nil); w.Code != http.StatusOK {
+		t.Errorf("Expected static files not to be limited, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	queuesHandler(w, httptest.NewRequest("GET", "/queues", nil))
+	var stats map[string]QueueStats
+	if err := json.Unmarshal(w.Body.Bytes(), &stats); err != nil {
+		t.Fatalf("Error reading the queue stats - %v", err)
+	}
+	if public := stats["public"]; public.Limit != 1 || public.Active != 1 || public.Waiting != 1 || public.Shed != 1 {
+		t.Errorf("Expected 1 active, 1 waiting and 1 turned away, got %+v", public)
+	}
+	if finish := stats["finish"]; finish.Served != 1 || finish.Shed != 0 {
+		t.Errorf("Expected the finish to be served, got %+v", finish)
+	}
+
+	close(unblock)
+	for x := 0; x < 2; x++ {
+		if code := <-done; code != http.StatusOK {
+			t.Errorf("Expected the queued spectators to be served, got %d", code)
+		}
+	}
+	if public := queueStats()["public"]; public.Served != 2 || public.Active != 0 || public.Waiting != 0 {
+		t.Errorf("Expected both spectators served, got %+v", public)
+	}
+}
@@ -2,44 +2,42 @@ package main
 
 import (
 	"bytes"
+	"cmp"
+	"context"
 	"crypto/md5"
 	"encoding/base64"
 	"encoding/csv"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"html/template"
 	"io"
-	"log"
+	"log/slog"
 	"mime/multipart"
 	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/mail"
 	"os"
-	"runtime"
+	"os/signal"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
-	"github.com/darkhelmet/env"
 	sendgrid "github.com/mzimmerman/sendgrid-go"
+	qrcode "github.com/skip2/go-qrcode"
 )
 
-var config struct {
-	webserverHostname string // the url to serve on - default localhost:8080
-	sendgriduser      string // the Sendgrid user for e-mail integration
-	sendgridpass      string // the Sendgrid password for e-mail integration
-	emailField        string // the title of the Email field in the uploaded CSV - default Email
-	emailFrom         string // the from address for the e-mail integration
-	raceName          string // Name of the race, default Campus Life 5k Orchard Run
-}
-
 type templateRequest struct {
-	name    string
-	writer  io.Writer
-	request *http.Request
+	name     string
+	writer   io.Writer
+	request  *http.Request
+	snapshot *RaceSnapshot // what to render, the race's current snapshot if nil
 }
 
 type TemplatePool struct {
@@ -70,7 +68,6 @@ const SENDGRIDUSER = "API_USER"
 const SENDGRIDPASS = "API_PASS"
 
 var headers = []string{"Fname", "Lname", "Age", "Gender", "Bib", "Overall Place", "Duration", "Time Finished", "Confirmed"}
-var serverHandlers chan struct{}
 var raceResultsTemplate *template.Template
 var raceResultsFuncMap template.FuncMap
 var errorTemplate *template.Template
@@ -78,49 +75,97 @@ var tmplPool *TemplatePool
 
 func init() {
 	tmplPool = NewTemplatePool()
-	config.webserverHostname = env.StringDefault("RACERGOHOSTNAME", "localhost:8080")
-	config.sendgriduser = env.StringDefault("RACERGOSENDGRIDUSER", SENDGRIDUSER)
-	config.sendgridpass = env.StringDefault("RACERGOSENDGRIDPASS", SENDGRIDPASS)
-	config.raceName = env.StringDefault("RACERGORACENAME", "Set RACERGORACENAME environment variable to change race name")
-	config.emailField = env.StringDefault("RACERGOEMAILFIELD", "Email")
-	config.emailFrom = env.StringDefault("RACERGOFROMEMAIL", "racergo@nonexistenthost.com")
-	numHandlers := runtime.NumCPU()
-	if numHandlers >= 2 {
-		// want to leave one cpu not handling racer http requests so as to handle the processing of racers quickly
-		numHandlers--
-	}
-	serverHandlers = make(chan struct{}, numHandlers)
-	for x := 0; x < numHandlers; x++ {
-		serverHandlers <- struct{}{} // fill the channel with valid goroutines
-	}
-	var err error
 	raceResultsFuncMap = template.FuncMap{"textequal": func(a, b string) bool {
 		return a == b
 	}}
-	raceResultsTemplate, err = template.New("template").Funcs(raceResultsFuncMap).ParseFiles("raceResults.template")
+	err := loadTemplates()
 	if err != nil {
-		log.Fatalf("Error parsing template - %s\n", err)
-		return
-	}
-	errorTemplate, err = template.ParseFiles("error.template")
-	if err != nil {
-		log.Fatalf("Error parsing template! - %s\n", err)
-		return
+		fatal("Error loading templates", "err", err)
 	}
 }
 
-const NoBib Bib = -1
+const NoBib Bib = ""
+
+const maxBibLength = 16
 
-type Bib int32
+// Bib is usually a number, but kids' runs and relay legs use ones like K12 or 1001A
+type Bib string
 
 func (b Bib) String() string {
-	if b < 0 {
+	if b == NoBib {
 		return "--"
 	}
-	return strconv.Itoa(int(b))
+	return string(b)
 }
 
-type Place uint16
+// ParseBib reads a typed, scanned or imported bib, letters are upper cased so k12 is K12 and numbers lose their leading
+// zeros so registration's 007 is the 7 that's typed at the finish, blank or -- is NoBib
+func ParseBib(val string) (Bib, error) {
+	val = strings.ToUpper(strings.TrimSpace(val))
+	if val == "" || val == "--" {
+		return NoBib, nil
+	}
+	if len(val) > maxBibLength {
+		return NoBib, fmt.Errorf("Bib %q is longer than %d characters", val, maxBibLength)
+	}
+	for _, c := range val {
+		if (c < '0' || c > '9') && (c < 'A' || c > 'Z') && c != '-' {
+			return NoBib, fmt.Errorf("Bib %q can only have letters, numbers and dashes", val)
+		}
+	}
+	if strings.Trim(val, "0123456789") == "" {
+		if val = strings.TrimLeft(val, "0"); val == "" {
+			val = "0"
+		}
+	}
+	return Bib(val), nil
+}
+
+// Compare orders bibs the way people count, so 9 is before 10 and K2 is before K10, numbers before letters, only the
+// same bib compares equal so K7 and K07 stay in a fixed order
+func (b Bib) Compare(other Bib) int {
+	x, y := string(b), string(other)
+	for x != "" && y != "" {
+		xDigits, yDigits := isDigit(x[0]), isDigit(y[0])
+		if xDigits != yDigits {
+			if xDigits {
+				return -1
+			}
+			return 1
+		}
+		var xRun, yRun string
+		xRun, x = leadingRun(x, xDigits)
+		yRun, y = leadingRun(y, yDigits)
+		if xDigits {
+			xRun, yRun = strings.TrimLeft(xRun, "0"), strings.TrimLeft(yRun, "0")
+			if c := cmp.Compare(len(xRun), len(yRun)); c != 0 {
+				return c
+			}
+		}
+		if c := strings.Compare(xRun, yRun); c != 0 {
+			return c
+		}
+	}
+	if c := cmp.Compare(len(x), len(y)); c != 0 {
+		return c
+	}
+	return strings.Compare(string(b), string(other))
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// leadingRun splits s after its leading digits, or its leading non-digits
+func leadingRun(s string, digits bool) (string, string) {
+	end := 0
+	for end < len(s) && isDigit(s[end]) == digits {
+		end++
+	}
+	return s[:end], s[end:]
+}
+
+type Place uint32
 
 func (p Place) String() string {
 	if p == 0 {
@@ -129,7 +174,7 @@ func (p Place) String() string {
 	return strconv.Itoa(int(p))
 }
 
-type Index uint16
+type Index uint32
 
 type Prize struct {
 	Title    string
@@ -159,7 +204,7 @@ func (e Entry) Place(p int) int {
 }
 
 func (e Entry) Nonce() string {
-	s := md5.Sum([]byte(fmt.Sprintf("%d%d%t%d%s%s%t%s", e.Age, e.Bib, e.Confirmed, e.Duration, e.Fname, e.Lname, e.Male, e.Optional)))
+	s := md5.Sum([]byte(fmt.Sprintf("%d%s%t%d%s%s%t%s", e.Age, e.Bib, e.Confirmed, e.Duration, e.Fname, e.Lname, e.Male, e.Optional)))
 	return base64.StdEncoding.EncodeToString(s[:])
 }
 
@@ -178,6 +223,7 @@ type Audit struct {
 	Duration HumanDuration
 	Bib      Bib
 	Remove   bool
+	Note     string // describes changes to the race itself, like moving the start
 }
 
 type EntrySort []*Entry
@@ -187,16 +233,20 @@ func (es *EntrySort) Len() int {
 }
 
 func (es *EntrySort) Less(i, j int) bool {
-	if (*es)[i].Duration == (*es)[j].Duration {
-		return (*es)[i].Bib < (*es)[j].Bib
-	}
-	if !(*es)[i].HasFinished() { // this entry didn't finish, it doesn't beat anyone
-		return false
-	}
-	if !(*es)[j].HasFinished() {
-		return true
-	}
-	return (*es)[i].Duration < (*es)[j].Duration
+	return compareEntries((*es)[i], (*es)[j]) < 0
+}
+
+// compareEntries orders the finishers fastest first, then everyone who hasn't finished, ties go by bib
+func compareEntries(a, b *Entry) int {
+	switch {
+	case a.HasFinished() && !b.HasFinished():
+		return -1
+	case !a.HasFinished() && b.HasFinished():
+		return 1
+	case a.HasFinished() && a.Duration != b.Duration:
+		return cmp.Compare(a.Duration, b.Duration)
+	}
+	return a.Bib.Compare(b.Bib)
 }
 
 func (es *EntrySort) Swap(i, j int) {
@@ -255,8 +305,8 @@ func ParseHumanDuration(val string) (HumanDuration, error) {
 }
 
 func downloadHandler(w http.ResponseWriter, r *http.Request, race *Race) {
-	filename := fmt.Sprintf(config.webserverHostname+"-%s.csv", time.Now().In(time.Local).Format("2006-01-02"))
-	w.Header().Set("Content-type", "application/csv")
+	filename := fmt.Sprintf(config.WebserverHostname+"-%s.csv", race.GetTime().In(time.Local).Format("2006-01-02"))
+	w.Header().Set("Content-type", "text/csv; charset=utf-8")
 	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
 	writer := csv.NewWriter(w)
 	race.WriteCSV(writer)
@@ -271,7 +321,7 @@ func gender(male bool) string {
 }
 
 func uploadPrizesHandler(w http.ResponseWriter, r *http.Request, race *Race) {
-	reader, err := r.MultipartReader()
+	reader, err := uploadReader(r)
 	if err != nil {
 		showErrorForAdmin(w, r.Referer(), "Error getting Reader - %s", err)
 		return
@@ -296,6 +346,7 @@ func uploadPrizesHandler(w http.ResponseWriter, r *http.Request, race *Race) {
 		newPrizes = append(newPrizes, prize)
 	}
 	race.SetPrizes(newPrizes)
+	race.raceEvent(actorOf(r), "upload prizes", "prizes", len(newPrizes))
 	http.Redirect(w, r, "/admin", 301)
 }
 
@@ -319,12 +370,12 @@ func calculatePrizes(r *Entry, prizes []Prize) {
 		}
 		found = true
 		prizes[p].Winners = append(prizes[p].Winners, r)
-		log.Printf("Placing #%d in prize %s, place %d", r.Bib, prizes[p].Title, len(prizes[p].Winners))
+		slog.Debug("Placing in prize", "bib", r.Bib, "prize", prizes[p].Title, "place", len(prizes[p].Winners))
 	}
 }
 
 func uploadRacersHandler(w http.ResponseWriter, r *http.Request, race *Race) {
-	reader, err := r.MultipartReader()
+	reader, err := uploadReader(r)
 	if err != nil {
 		showErrorForAdmin(w, r.Referer(), "Error getting Reader - %s", err)
 		return
@@ -406,7 +457,7 @@ func uploadRacersHandler(w http.ResponseWriter, r *http.Request, race *Race) {
 	}
 	// load the data
 	for row := 1; row < len(rawEntries); row++ {
-		entry := Entry{Bib: -1}
+		entry := Entry{Bib: NoBib}
 		entry.Optional = make([]string, 0)
 		for col := range rawEntries[row] {
 			switch rawEntries[0][col] {
@@ -420,11 +471,10 @@ func uploadRacersHandler(w http.ResponseWriter, r *http.Request, race *Race) {
 			case "Gender":
 				entry.Male = (rawEntries[row][col] == "M")
 			case "Bib":
-				tmpBib, err := strconv.Atoi(rawEntries[row][col])
+				entry.Bib, err = ParseBib(rawEntries[row][col])
 				if err != nil {
-					entry.Bib = -1
-				} else {
-					entry.Bib = Bib(tmpBib)
+					showErrorForAdmin(w, r.Referer(), "Error on row %d - %v.  Import failed.", row+1, err)
+					return
 				}
 			case "Overall Place":
 				// ignore since this will be calculated on sort
@@ -442,10 +492,10 @@ func uploadRacersHandler(w http.ResponseWriter, r *http.Request, race *Race) {
 			}
 		}
 		if _, ok := newBibbedEntries[entry.Bib]; ok {
-			showErrorForAdmin(w, r.Referer(), "Duplicate bib #%d detected in uploaded CSV file.  Import failed.", entry.Bib)
+			showErrorForAdmin(w, r.Referer(), "Duplicate bib #%s detected in uploaded CSV file.  Import failed.", entry.Bib)
 			return
 		}
-		if entry.Bib >= 0 {
+		if entry.Bib != NoBib {
 			newBibbedEntries[entry.Bib] = entry
 		}
 		newAllEntries = append(newAllEntries, entry)
@@ -462,6 +512,7 @@ func uploadRacersHandler(w http.ResponseWriter, r *http.Request, race *Race) {
 			return
 		}
 	}
+	race.raceEvent(actorOf(r), "upload racers", "entries", len(newAllEntries))
 	http.Redirect(w, r, "/admin", 301)
 }
 
@@ -471,21 +522,261 @@ func startHandler(w http.ResponseWriter, r *http.Request, race *Race) {
 		showErrorForAdmin(w, r.Referer(), "Error starting race - %s", err)
 		return
 	}
+	race.RLock()
+	started := race.started
+	race.RUnlock()
+	race.raceEvent(actorOf(r), "start", "at", started)
+	http.Redirect(w, r, "/admin", 301)
+}
+
+// AdjustStart moves the start of a started race, finishers keep the time they crossed the line so their durations,
+// places and prizes are recomputed from the new start
+func (race *Race) AdjustStart(start time.Time) error {
+	race.Lock()
+	defer race.Unlock()
+	return race.lockedAdjustStart(start)
+}
+
+// AdjustStartBy moves the start by offset from wherever it is when the lock is taken, so two adjustments both count
+func (race *Race) AdjustStartBy(offset time.Duration) error {
+	race.Lock()
+	defer race.Unlock()
+	return race.lockedAdjustStart(race.started.Add(offset))
+}
+
+func (race *Race) lockedAdjustStart(start time.Time) error {
+	if race.started.IsZero() {
+		return fmt.Errorf("Race has not started yet, start or schedule it instead")
+	}
+	if start.After(race.GetTime()) {
+		return fmt.Errorf("Cannot move the start to %s, it's in the future", start.Format("3:04:05.00"))
+	}
+	for _, entry := range race.allEntries {
+		if entry.HasFinished() && !entry.TimeFinished.After(start) {
+			return fmt.Errorf("Cannot move the start to %s, bib #%s finished at %s", start.Format("3:04:05.00"), entry.Bib, entry.TimeFinished.Format("3:04:05.00"))
+		}
+	}
+	old := race.started
+	race.started = start
+	race.entriesChanged()
+	for _, entry := range race.allEntries {
+		if entry.HasFinished() {
+			entry.Duration = HumanDuration(entry.TimeFinished.Sub(start))
+		}
+	}
+	note := fmt.Sprintf("Start moved from %s to %s (%s)", old.Format("3:04:05.00"), start.Format("3:04:05.00"), start.Sub(old))
+	race.lockedAudit(Audit{
+		Bib:  NoBib,
+		Note: note,
+	})
+	slog.Info(note)
+	race.lockedSortEntries()
+	race.lockedRecomputePrizes()
+	race.startRaceChan <- race.started
+	race.events.Publish("start", unixMillis(race.started))
+	return nil
+}
+
+// StartAt starts the race at a time read off a stopwatch or gun timer, if it's already started the start is moved there
+// instead, the same as AdjustStart, as long as everyone recorded still finishes after it
+func (race *Race) StartAt(start time.Time) error {
+	race.Lock()
+	defer race.Unlock()
+	if !race.started.IsZero() {
+		if race.started.Equal(start) {
+			return nil
+		}
+		return race.lockedAdjustStart(start)
+	}
+	if start.After(race.GetTime()) {
+		return fmt.Errorf("Cannot start the race at %s, it's in the future, schedule it instead", start.Format(time.ANSIC))
+	}
+	race.lockedStart(start)
+	return nil
+}
+
+// ResetStart is for a false start, it clears the start and every finish time as long as none have been confirmed
+func (race *Race) ResetStart() error {
+	race.Lock()
+	defer race.Unlock()
+	if race.started.IsZero() {
+		return fmt.Errorf("Race has not started yet, nothing to reset")
+	}
+	for _, entry := range race.allEntries {
+		if entry.Confirmed {
+			return fmt.Errorf("Bib #%s is already confirmed, adjust the start time instead", entry.Bib)
+		}
+	}
+	for _, entry := range race.allEntries {
+		entry.Duration = 0
+		entry.TimeFinished = time.Time{}
+	}
+	race.entriesChanged()
+	note := fmt.Sprintf("Race reset after a false start at %s", race.started.Format("3:04:05.00"))
+	race.lockedAudit(Audit{
+		Bib:  NoBib,
+		Note: note,
+	})
+	slog.Info(note)
+	race.started = time.Time{}
+	race.lastConfirmed = NoBib
+	race.lockedSortEntries()
+	race.lockedRecomputePrizes()
+	race.startRaceChan <- race.started
+	race.events.Publish("reset", 0)
+	return nil
+}
+
+// adjustStartHandler moves the start by an offset (offset=-2.5s), to a time (at=07:30:02.50), or resets it (reset=true)
+func adjustStartHandler(w http.ResponseWriter, r *http.Request, race *Race) {
+	var err error
+	event := "adjust start"
+	switch {
+	case r.FormValue("reset") == "true":
+		event = "reset start"
+		err = race.ResetStart()
+	case r.FormValue("offset") != "":
+		var offset time.Duration
+		offset, err = time.ParseDuration(r.FormValue("offset"))
+		if err == nil {
+			err = race.AdjustStartBy(offset)
+		}
+	default:
+		var at time.Time
+		at, err = formStartTime(r, race)
+		if err == nil {
+			err = race.AdjustStart(at)
+		}
+	}
+	if err != nil {
+		showErrorForAdmin(w, r.Referer(), "Error adjusting race start - %s", err)
+		return
+	}
+	race.RLock()
+	started := race.started
+	race.RUnlock()
+	race.raceEvent(actorOf(r), event, "at", started)
+	http.Redirect(w, r, "/admin", 301)
+}
+
+// startAtHandler starts the race at a time from a stopwatch or gun timer (at=07:30:02.50&tz=America/Chicago), or moves
+// the start there if the race is running, API clients asking for JSON get the start back
+func startAtHandler(w http.ResponseWriter, r *http.Request, race *Race) {
+	at, err := formStartTime(r, race)
+	if err == nil {
+		err = race.StartAt(at)
+	}
+	if err != nil {
+		showErrorForAdmin(w, r.Referer(), "Error starting race - %s", err)
+		return
+	}
+	race.raceEvent(actorOf(r), "start at", "at", at)
+	if strings.Contains(r.Header.Get("Accept"), "application/json") {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"started": at.Format(time.RFC3339Nano)})
+		return
+	}
+	http.Redirect(w, r, "/admin", 301)
+}
+
+// formStartTime reads the at and tz form values, times without a date are on the same day as the race
+func formStartTime(r *http.Request, race *Race) (time.Time, error) {
+	loc, err := parseTimeZone(r.FormValue("tz"))
+	if err != nil {
+		return time.Time{}, err
+	}
+	race.RLock()
+	day := race.started
+	race.RUnlock()
+	if day.IsZero() {
+		day = race.GetTime()
+	}
+	return parseStartTime(r.FormValue("at"), day.In(loc))
+}
+
+// parseTimeZone reads a time zone by name (America/Chicago) or UTC offset (-05:00), the server's zone if it's blank
+func parseTimeZone(tz string) (*time.Location, error) {
+	if tz == "" {
+		return time.Local, nil
+	}
+	for _, layout := range []string{"-07:00", "-0700", "-07", "Z07:00"} {
+		if t, err := time.Parse(layout, tz); err == nil {
+			_, offset := t.Zone()
+			return time.FixedZone(tz, offset), nil
+		}
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return nil, fmt.Errorf("%q is not a time zone, use a name like America/Chicago or an offset like -05:00", tz)
+	}
+	return loc, nil
+}
+
+// parseStartTime reads a start time given as 15:04 or 15:04:05.00 on the same day as now, as 2006-01-02T15:04 from a
+// datetime-local input, or as RFC 3339 with its own offset, all but RFC 3339 are in now's time zone
+func parseStartTime(val string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339Nano, val); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02 15:04:05", "2006-01-02 15:04"} {
+		if t, err := time.ParseInLocation(layout, val, now.Location()); err == nil {
+			return t, nil
+		}
+	}
+	for _, layout := range []string{"15:04:05", "15:04"} {
+		if t, err := time.ParseInLocation(layout, val, now.Location()); err == nil {
+			return time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), now.Location()), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%q is not a time, use 15:04 or 2006-01-02T15:04", val)
+}
+
+// scheduleStartHandler schedules the start at a time (at=15:04) or after a countdown (in=5m), or cancels it (cancel=true)
+func scheduleStartHandler(w http.ResponseWriter, r *http.Request, race *Race) {
+	var err error
+	switch {
+	case r.FormValue("cancel") == "true":
+		err = race.CancelScheduledStart()
+		if err == nil {
+			race.raceEvent(actorOf(r), "cancel schedule")
+		}
+	case r.FormValue("in") != "":
+		var countdown time.Duration
+		countdown, err = time.ParseDuration(r.FormValue("in"))
+		if err == nil {
+			err = race.ScheduleStart(race.GetTime().Add(countdown))
+		}
+	default:
+		var at time.Time
+		at, err = parseStartTime(r.FormValue("at"), race.GetTime())
+		if err == nil {
+			err = race.ScheduleStart(at)
+		}
+	}
+	if err != nil {
+		showErrorForAdmin(w, r.Referer(), "Error scheduling race start - %s", err)
+		return
+	}
+	if r.FormValue("cancel") != "true" {
+		race.RLock()
+		scheduled := race.scheduled
+		race.RUnlock()
+		race.raceEvent(actorOf(r), "schedule", "at", scheduled)
+	}
 	http.Redirect(w, r, "/admin", 301)
 }
 
 func linkBibHandler(w http.ResponseWriter, r *http.Request, race *Race) {
 	removeBib := r.FormValue("remove") == "true"
-	tmpBib, err := strconv.Atoi(r.FormValue("bib"))
+	bib, err := ParseBib(r.FormValue("bib"))
 	if err != nil {
-		showErrorForAdmin(w, r.Referer(), "Error %s getting bib number", err)
+		showErrorForAdmin(w, r.Referer(), "%v", err)
 		return
 	}
-	if tmpBib < 0 {
-		showErrorForAdmin(w, r.Referer(), "Cannot assign a negative bib number of %d", tmpBib)
+	if bib == NoBib {
+		showErrorForAdmin(w, r.Referer(), "No bib given")
 		return
 	}
-	bib := Bib(tmpBib)
 	if removeBib {
 		err = race.RemoveTimeForBib(bib)
 	} else {
@@ -495,68 +786,94 @@ func linkBibHandler(w http.ResponseWriter, r *http.Request, race *Race) {
 		showErrorForAdmin(w, r.Referer(), "%v", err)
 		return
 	}
+	event := "remove"
+	if !removeBib {
+		event = "link"
+		race.links.Add(race.GetTime())
+	}
+	race.raceEvent(actorOf(r), event, "bib", bib, "duration", race.durationOf(bib))
 	if r.FormValue("scanned") == "true" {
 		err = race.ConfirmTimeForBib(bib)
 		if err != nil {
 			showErrorForAdmin(w, r.Referer(), "%v", err)
 			return
 		}
+		race.raceEvent(actorOf(r), "confirm", "bib", bib, "duration", race.durationOf(bib))
 	}
 	http.Redirect(w, r, r.Referer(), 301)
 }
 
-func sendEmailResponse(e Entry, hd HumanDuration, emailIndex int) {
+// sendEmailResponse e-mails the runner their time, retrying until it goes out or ctx is done, true if it was sent
+func sendEmailResponse(ctx context.Context, e Entry, hd HumanDuration, emailIndex int, failures *atomic.Uint64) bool {
 	if emailIndex == -1 { // no e-mail address was found on data load, just return
-		return
+		return false
 	}
 	emailAddr := e.Optional[emailIndex]
 	_, err := mail.ParseAddress(emailAddr)
 	if err != nil {
-		log.Printf("Error parsing e-mail address of %s\n", emailAddr)
-		return
+		slog.Warn("Not e-mailing results to an invalid address", "bib", e.Bib, "to", emailAddr)
+		return false
 	}
 	m := sendgrid.NewMail()
-	client := sendgrid.NewSendGridClient(config.sendgriduser, config.sendgridpass)
+	client := sendgrid.NewSendGridClient(config.SendgridUser, config.SendgridPass)
 	m.AddTo(fmt.Sprintf("%s %s <%s>", e.Fname, e.Lname, emailAddr))
-	m.SetSubject(fmt.Sprintf("%s Results", config.raceName))
-	m.SetText(fmt.Sprintf("Congratulations %s %s!  You finished the %s in %s!", e.Fname, e.Lname, config.raceName, hd))
-	m.SetFrom(config.emailFrom)
+	m.SetSubject(fmt.Sprintf("%s Results", config.RaceName))
+	m.SetText(fmt.Sprintf("Congratulations %s %s!  You finished the %s in %s!", e.Fname, e.Lname, strings.TrimSpace(config.RaceName+" "+config.Distance), hd))
+	m.SetFrom(config.EmailFrom)
 	backoff := time.Second
 	for {
 		err := client.Send(m)
 		if err == nil {
-			log.Printf("Success sending %#v", m)
-			return
+			slog.Info("Sent results e-mail", "bib", e.Bib, "to", emailAddr)
+			return true
 		}
+		failures.Add(1)
 		backoff = backoff * 2
-		log.Printf("Error sending mail to %s - %v, trying again in %s", emailAddr, err, backoff)
-		time.Sleep(backoff)
+		slog.Warn("Error sending results e-mail, retrying", "bib", e.Bib, "to", emailAddr, "err", err, "backoff", backoff)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			slog.Warn("Shutting down, not sending results e-mail", "bib", e.Bib, "to", emailAddr)
+			return false
+		}
 	}
 }
 
 func showErrorForAdmin(w http.ResponseWriter, referrer string, message string, args ...interface{}) {
 	w.WriteHeader(409) // conflict header, most likely due to old information in the client
 	msg := fmt.Sprintf(message, args...)
-	log.Println(msg)
-	if errorTemplate == nil {
-		fmt.Fprintf(w, msg)
+	slog.Warn(msg, "referrer", referrer)
+	_, errorTemplate, err := currentTemplates()
+	if err != nil || errorTemplate == nil {
+		fmt.Fprint(w, msg)
 		return
 	}
-	err := errorTemplate.Execute(w, map[string]interface{}{"Message": msg, "Referrer": referrer})
+	err = errorTemplate.Execute(w, map[string]interface{}{"Message": msg, "Referrer": referrer})
 	if err != nil {
 		fmt.Fprintf(w, "Error executing template - %s", err)
 	}
 }
 
-func recomputeAllPrizes(prizes []Prize, allEntries []*Entry) {
-	for p := range prizes {
-		prizes[p].Winners = prizes[p].Winners[:0]
+// lockedRecomputePrizes awards every prize again starting from the first finisher
+func (race *Race) lockedRecomputePrizes() {
+	race.changed()
+	for p := range race.prizes {
+		race.prizes[p].Winners = race.prizes[p].Winners[:0]
 	}
-	for _, v := range allEntries {
-		if !v.Confirmed {
-			break // all done
-		}
-		calculatePrizes(v, prizes)
+	race.prized = 0
+	race.lockedUpdatePrizes(0)
+}
+
+// lockedUpdatePrizes brings the prizes up to date after allEntries changed from index changed on, prizes go to the
+// confirmed finishers in order so unless the change is among the ones already placed only the new ones are added
+func (race *Race) lockedUpdatePrizes(changed int) {
+	if changed < race.prized {
+		race.lockedRecomputePrizes()
+		return
+	}
+	for race.prized < len(race.allEntries) && race.allEntries[race.prized].Confirmed {
+		calculatePrizes(race.allEntries[race.prized], race.prizes)
+		race.prized++
 	}
 }
 
@@ -571,10 +888,9 @@ func parseEntry(r *http.Request, race *Race) (Entry, error) {
 		return entry, fmt.Errorf("Error %v getting Age", err)
 	}
 	entry.Age = uint(age)
-	tmpBib, err := strconv.Atoi(r.FormValue("Bib"))
-	entry.Bib = Bib(tmpBib)
+	entry.Bib, err = ParseBib(r.FormValue("Bib"))
 	if err != nil {
-		return entry, fmt.Errorf("Error %v getting Bib", err)
+		return entry, err
 	}
 	entry.Fname = r.FormValue("Fname")
 	entry.Lname = r.FormValue("Lname")
@@ -601,7 +917,8 @@ func addEntryHandler(w http.ResponseWriter, r *http.Request, race *Race) {
 	if strings.Contains(r.Referer(), "/admin") {
 		page = "admin"
 	}
-	referTo := fmt.Sprintf("http://%s/%s?%s", config.webserverHostname, page, r.Form.Encode())
+	r.Form.Del("csrf") // the form is echoed back on errors, don't put the token in the url
+	referTo := fmt.Sprintf("/%s?%s", page, r.Form.Encode())
 	if err != nil {
 		showErrorForAdmin(w, referTo, "%v", err)
 		return
@@ -611,24 +928,27 @@ func addEntryHandler(w http.ResponseWriter, r *http.Request, race *Race) {
 		showErrorForAdmin(w, referTo, "%v", err)
 		return
 	}
+	race.raceEvent(actorOf(r), "add entry", "bib", entry.Bib, "fname", entry.Fname, "lname", entry.Lname)
 	http.Redirect(w, r, fmt.Sprintf("/%s", page), 301)
 	return
 }
 
 func handler(w http.ResponseWriter, r *http.Request, race *Race) {
-	<-serverHandlers // wait until a goroutine to handle http requests is free
-	defer func() {
-		serverHandlers <- struct{}{} // wait for handler to finish, then put it back in the queue so another handler can work
-	}()
+	snap := race.Snapshot()
+	if !config.Dev && notModified(w, r, pageETag(snap, r), snap.Modified) {
+		return // nothing has changed since this client's copy, no need to render it
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	err := race.GenerateTemplate(templateRequest{
-		name:    strings.Trim(r.URL.Path, "/"),
-		writer:  w,
-		request: r,
+		name:     strings.SplitN(strings.Trim(r.URL.Path, "/"), "/", 2)[0],
+		writer:   w,
+		request:  r,
+		snapshot: snap,
 	})
 	if err != nil {
 		w.WriteHeader(500)
 		fmt.Fprintf(w, "Error executing template - %v", err)
-		log.Printf("Error executing template - %v", err)
+		slog.Error("Error executing template", "path", r.URL.Path, "err", err)
 	}
 }
 
@@ -664,6 +984,49 @@ func uploadFile(filename string) (*http.Request, error) {
 	//io.Copy(os.Stderr, res.Body) // Replace this with Status.Code check
 }
 
+// runnerBib parses the bib out of /runner/{bib} and /runner/{bib}/qr.png, reporting which it was, any other path is NoBib
+func runnerBib(path string) (Bib, bool) {
+	rest, ok := strings.CutPrefix(path, "/runner/")
+	if !ok {
+		return NoBib, false
+	}
+	parts := strings.Split(rest, "/")
+	if len(parts) > 2 || len(parts) == 2 && parts[1] != "qr.png" {
+		return NoBib, false
+	}
+	bib, err := ParseBib(parts[0])
+	if err != nil {
+		return NoBib, false
+	}
+	return bib, len(parts) == 2
+}
+
+// runnerURL is the permanent address of a runner's result page, on the host the request used
+func runnerURL(r *http.Request, bib Bib) string {
+	return requestURL(r, fmt.Sprintf("/runner/%s", bib))
+}
+
+func runnerHandler(w http.ResponseWriter, r *http.Request, race *Race) {
+	bib, qr := runnerBib(r.URL.Path)
+	if _, ok := race.Snapshot().Bibbed[bib]; !ok {
+		http.NotFound(w, r) // the page's address is shared, a bib that isn't in the race shouldn't look like one
+		return
+	}
+	if qr {
+		png, err := qrcode.Encode(runnerURL(r, bib), qrcode.Medium, 256)
+		if err != nil {
+			w.WriteHeader(500)
+			fmt.Fprintf(w, "Error generating QR code - %v", err)
+			slog.Error("Error generating QR code", "err", err)
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(png)
+		return
+	}
+	handler(w, r, race)
+}
+
 func (race *Race) RecordTimeForBib(bib Bib) error {
 	race.Lock()
 	defer race.Unlock()
@@ -672,25 +1035,25 @@ func (race *Race) RecordTimeForBib(bib Bib) error {
 	}
 	entry, ok := race.bibbedEntries[bib]
 	if !ok {
-		return fmt.Errorf("Bib %d not found", bib)
+		return fmt.Errorf("Bib %s not found", bib)
 	}
 	now := race.GetTime()
 	duration := HumanDuration(now.Sub(race.started))
-	race.auditLog = append(race.auditLog, Audit{
+	race.lockedAudit(Audit{
 		Duration: duration,
 		Bib:      bib,
 		Remove:   false,
 	})
 	if entry.HasFinished() {
 		if entry.Confirmed {
-			return fmt.Errorf("Bib #%d already confirmed!", bib)
+			return fmt.Errorf("Bib #%s already confirmed!", bib)
 		}
 		return nil
 	}
 	entry.Duration = duration
 	entry.TimeFinished = now
-	race.lockedSortEntries()
-	log.Printf("Bib #%d linked with duration - %s", bib, entry.Duration)
+	race.lockedUpdatePrizes(race.lockedReposition(entry))
+	slog.Info("Bib linked", "bib", bib, "duration", entry.Duration)
 	return nil
 
 }
@@ -703,14 +1066,14 @@ func (race *Race) ConfirmTimeForBib(bib Bib) error {
 	}
 	entry, ok := race.bibbedEntries[bib]
 	if !ok {
-		return fmt.Errorf("Bib %d not found", bib)
+		return fmt.Errorf("Bib %s not found", bib)
 	}
 	if entry.Confirmed {
-		return fmt.Errorf("Bib #%d already confirmed!", bib)
+		return fmt.Errorf("Bib #%s already confirmed!", bib)
 	}
 	now := race.GetTime()
 	duration := HumanDuration(now.Sub(race.started))
-	race.auditLog = append(race.auditLog, Audit{
+	race.lockedAudit(Audit{
 		Duration: duration,
 		Bib:      bib,
 		Remove:   false,
@@ -720,11 +1083,11 @@ func (race *Race) ConfirmTimeForBib(bib Bib) error {
 		entry.TimeFinished = now
 	}
 	entry.Confirmed = true
-	log.Printf("Bib #%d confirmed with duration - %s", bib, entry.Duration)
+	race.lastConfirmed = bib
+	slog.Info("Bib confirmed", "bib", bib, "duration", entry.Duration)
 	// TODO: Verify that every entry before them is *also* confirmed, otherwise their finishing place could be wrong
-	race.lockedSortEntries()
-	recomputeAllPrizes(race.prizes, race.allEntries)
-	go sendEmailResponse(*entry, entry.Duration, race.optionalEmailIndex)
+	race.lockedUpdatePrizes(race.lockedReposition(entry))
+	emails.Send(*entry, entry.Duration, race.optionalEmailIndex)
 	return nil
 }
 
@@ -733,9 +1096,9 @@ func (race *Race) RemoveTimeForBib(bib Bib) error {
 	defer race.Unlock()
 	entry, ok := race.bibbedEntries[bib]
 	if !ok {
-		return fmt.Errorf("Bib %d not found", bib)
+		return fmt.Errorf("Bib %s not found", bib)
 	}
-	race.auditLog = append(race.auditLog, Audit{
+	race.lockedAudit(Audit{
 		Duration: HumanDuration(race.GetTime().Sub(race.started)),
 		Bib:      bib,
 		Remove:   true,
@@ -744,13 +1107,13 @@ func (race *Race) RemoveTimeForBib(bib Bib) error {
 		if entry.HasFinished() {
 			entry.Duration = 0
 			entry.TimeFinished = time.Time{}
-			race.lockedSortEntries()
-			log.Printf("Removed time for racer #%d", bib)
+			race.lockedUpdatePrizes(race.lockedReposition(entry))
+			slog.Info("Bib's time removed", "bib", bib)
 			return nil
 		}
-		return fmt.Errorf("Cannot remove time for bib #%d, time is already removed.", bib)
+		return fmt.Errorf("Cannot remove time for bib #%s, time is already removed.", bib)
 	}
-	return fmt.Errorf("Bib #%d already confirmed!", bib)
+	return fmt.Errorf("Bib #%s already confirmed!", bib)
 }
 
 func (race *Race) normalizeEntry(entry *Entry) error {
@@ -780,27 +1143,49 @@ func (race *Race) AddEntry(entry Entry) error {
 	if err != nil {
 		return err
 	}
-	if entry.Bib >= 0 {
+	if entry.Bib != NoBib {
 		if _, ok := race.bibbedEntries[entry.Bib]; ok {
-			return fmt.Errorf("Entry already exists for bib #%d", entry.Bib)
+			return fmt.Errorf("Entry already exists for bib #%s", entry.Bib)
 		}
-		race.allEntries = append(race.allEntries, &entry)
 		race.bibbedEntries[entry.Bib] = &entry
 	} else {
 		if !race.started.IsZero() {
 			return fmt.Errorf("Entry does not contain a bib # and the race has started!")
 		}
-		race.allEntries = append(race.allEntries, &entry)
 	}
-	log.Printf("Added Entry - %#v\n", entry)
-	race.lockedSortEntries()
-	recomputeAllPrizes(race.prizes, race.allEntries)
+	slog.Debug("Added entry", "bib", entry.Bib, "fname", entry.Fname, "lname", entry.Lname)
+	race.lockedUpdatePrizes(race.lockedReposition(&entry))
 	return nil
 }
 
 func (race *Race) lockedSortEntries() {
 	sorted := EntrySort(race.allEntries)
 	sort.Sort(&sorted)
+	race.entriesChanged() // the copies are in the old order
+}
+
+// lockedReposition moves entry to its place in allEntries after it changed, or adds it if it's new, everyone else is
+// still in order so it's a binary search instead of a sort, it returns the first index that changed
+func (race *Race) lockedReposition(entry *Entry) int {
+	race.changed()
+	old := slices.Index(race.allEntries, entry)
+	if old >= 0 {
+		race.allEntries = slices.Delete(race.allEntries, old, old+1)
+		race.entryCopies = slices.Delete(race.entryCopies, old, old+1)
+	}
+	at, _ := slices.BinarySearchFunc(race.allEntries, entry, compareEntries)
+	race.allEntries = slices.Insert(race.allEntries, at, entry)
+	race.entryCopies = slices.Insert(race.entryCopies, at, nil) // its copy, if it had one, is out of date
+	if old >= 0 && old < at {
+		return old
+	}
+	return at
+}
+
+// lockedAudit records an action in the audit log
+func (race *Race) lockedAudit(a Audit) {
+	race.auditLog = append(race.auditLog, a)
+	race.changed()
 }
 
 type RecentRacer struct {
@@ -808,10 +1193,187 @@ type RecentRacer struct {
 	Place Place
 }
 
+// RunnerResult is an Entry along with every placement a runner would want to look up
+type RunnerResult struct {
+	*Entry
+	Place         Place // overall place, only set once the entry has finished
+	GenderPlace   Place
+	AgeGroup      string // title of the narrowest prize category the entry is eligible for
+	AgeGroupPlace Place
+	Prizes        []string // titles of the prizes the entry has won
+}
+
+// ageGroup returns the index of the narrowest prize category by age that the entry is eligible for, -1 if none
+func ageGroup(e *Entry, prizes []Prize) int {
+	group := -1
+	for p := range prizes {
+		switch {
+		case e.Age < prizes[p].LowAge || e.Age > prizes[p].HighAge:
+			continue
+		case e.Male && prizes[p].Gender == "F":
+			continue
+		case !e.Male && prizes[p].Gender == "M":
+			continue
+		case group == -1:
+			group = p
+		case prizes[p].HighAge-prizes[p].LowAge < prizes[group].HighAge-prizes[group].LowAge:
+			group = p
+		}
+	}
+	return group
+}
+
+// computeResults computes the placements for every entry, in the same order as entries
+func computeResults(entries []*Entry, prizes []Prize) []RunnerResult {
+	won := make(map[*Entry][]string)
+	for _, prize := range prizes {
+		for _, w := range prize.Winners {
+			won[w] = append(won[w], prize.Title)
+		}
+	}
+	results := make([]RunnerResult, len(entries))
+	var males, females Place
+	groupPlaces := make(map[string]Place)
+	for i, e := range entries {
+		results[i] = RunnerResult{
+			Entry:  e,
+			Prizes: won[e],
+		}
+		group := ageGroup(e, prizes)
+		if group >= 0 {
+			results[i].AgeGroup = prizes[group].Title
+		}
+		if !e.HasFinished() {
+			continue
+		}
+		results[i].Place = Place(i + 1)
+		if e.Male {
+			males++
+			results[i].GenderPlace = males
+		} else {
+			females++
+			results[i].GenderPlace = females
+		}
+		if group >= 0 {
+			groupPlaces[results[i].AgeGroup]++
+			results[i].AgeGroupPlace = groupPlaces[results[i].AgeGroup]
+		}
+	}
+	return results
+}
+
+// Runner returns the placements for the entry with the given bib
+func (s *RaceSnapshot) Runner(bib Bib) (RunnerResult, bool) {
+	entry, ok := s.Bibbed[bib]
+	if !ok {
+		return RunnerResult{}, false
+	}
+	for _, result := range s.Results {
+		if result.Entry == entry {
+			return result, true
+		}
+	}
+	return RunnerResult{}, false
+}
+
+const maxSearchResults = 25
+
+// Search finds the entries matching a bib number or (fuzzily) the runner's name
+func (s *RaceSnapshot) Search(query string) []RunnerResult {
+	query = strings.ToLower(strings.TrimSpace(query))
+	if query == "" {
+		return nil
+	}
+	terms := strings.Fields(query)
+	bib, _ := ParseBib(query)
+	type match struct {
+		result RunnerResult
+		score  int
+	}
+	matches := make([]match, 0, maxSearchResults)
+	for _, result := range s.Results {
+		if bib != NoBib && result.Bib == bib {
+			matches = append(matches, match{result: result, score: -1}) // an exact bib match beats any name match
+			continue
+		}
+		score := 0
+		for _, term := range terms {
+			distance := nameDistance(term, result.Fname, result.Lname)
+			if distance < 0 {
+				score = -1
+				break
+			}
+			score += distance
+		}
+		if score >= 0 {
+			matches = append(matches, match{result: result, score: score})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].score < matches[j].score
+	})
+	if len(matches) > maxSearchResults {
+		matches = matches[:maxSearchResults]
+	}
+	results := make([]RunnerResult, len(matches))
+	for x := range matches {
+		results[x] = matches[x].result
+	}
+	return results
+}
+
+// nameDistance returns how closely the search term matches either name, 0 being a prefix match, -1 being no match
+func nameDistance(term string, names ...string) int {
+	allowed := 0
+	switch {
+	case len(term) >= 7:
+		allowed = 2
+	case len(term) >= 4:
+		allowed = 1
+	}
+	best := -1
+	for _, name := range names {
+		name = strings.ToLower(name)
+		if strings.HasPrefix(name, term) {
+			return 0
+		}
+		if len(name) > len(term) {
+			name = name[:len(term)] // compare against the prefix so partial names still match
+		}
+		if d := levenshtein(term, name); d <= allowed && (best == -1 || d < best) {
+			best = d
+		}
+	}
+	return best
+}
+
+func levenshtein(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+// GenerateTemplate renders the page from the race's current snapshot, it never locks the race
 func (race *Race) GenerateTemplate(req templateRequest) error {
-	race.Lock()
-	defer race.Unlock()
-	data := map[string]interface{}{"Entries": race.allEntries}
+	snap := req.snapshot
+	if snap == nil {
+		snap = race.Snapshot()
+	}
+	data := map[string]interface{}{"Entries": snap.Entries}
 	req.request.ParseForm()
 	for key, val := range req.request.Form {
 		data[key] = val[0]
@@ -819,42 +1381,82 @@ func (race *Race) GenerateTemplate(req templateRequest) error {
 	switch req.name {
 	default:
 		req.name = "default"
+		data["Table"] = snap.Table(parseTableQuery(req.request))
 	case "audit":
-		data["Audit"] = race.auditLog
+		data["Audit"] = snap.Audit
 		fallthrough
 	case "admin":
-		data["Fields"] = race.optionalEntryFields
+		data["Fields"] = snap.OptionalEntryFields
 		data["Admin"] = true
+		data["Table"] = snap.Table(parseTableQuery(req.request))
 		fallthrough
 	case "results":
 		numRecent := 10
 		recentRacers := make([]RecentRacer, 0, numRecent)
-		for i := len(race.allEntries) - 1; i >= 0; i-- {
-			if race.allEntries[i].HasFinished() {
-				if !race.allEntries[i].Confirmed || len(recentRacers) < numRecent {
+		for i := len(snap.Entries) - 1; i >= 0; i-- {
+			if snap.Entries[i].HasFinished() {
+				if !snap.Entries[i].Confirmed || len(recentRacers) < numRecent {
 					// add all unconfirmed racers that have finished, but only add confirmed recent racers up to length of numRecent
 					recentRacers = append(recentRacers, RecentRacer{
-						Entry: race.allEntries[i],
+						Entry: snap.Entries[i],
 						Place: Place(i + 1),
 					})
 				}
 			}
 		}
 		data["RecentRacers"] = recentRacers
+		if result, ok := snap.Runner(snap.LastConfirmed); ok {
+			data["LastConfirmed"] = result
+		}
 	case "dayof":
+	case "login":
+	case "scanner":
+	case "search":
+		data["Results"] = snap.Search(req.request.FormValue("q"))
+	case "bibs":
+		low, high, err := bibRange(req.request) // already validated by bibLabelsHandler
+		if err != nil {
+			return err
+		}
+		labels, err := snap.BibLabels(low, high)
+		if err != nil {
+			return err
+		}
+		data["Labels"] = labels
+	case "runner":
+		bib, _ := runnerBib(req.request.URL.Path)
+		if result, ok := snap.Runner(bib); ok {
+			data["Runner"] = result
+			events := make([]Audit, 0)
+			for _, a := range snap.Audit {
+				if a.Bib == bib {
+					events = append(events, a)
+				}
+			}
+			data["Events"] = events
+		}
 	}
-	if !race.started.IsZero() {
-		diff := time.Since(race.started)
-		data["Start"] = race.started.Format("3:04:05")
-		data["Time"] = HumanDuration(diff).Clock()
-		data["Seconds"] = fmt.Sprintf("%.0f", diff.Seconds())
-		data["NextUpdate"] = diff / time.Millisecond % 1000
-	}
-	data["Prizes"] = race.prizes
+	now := race.GetTime()
+	if !snap.Started.IsZero() {
+		data["Start"] = snap.Started.Format("3:04:05")
+		data["Time"] = HumanDuration(now.Sub(snap.Started)).Clock()
+	} else if !snap.Scheduled.IsZero() {
+		data["Scheduled"] = snap.Scheduled.Format("3:04:05")
+		data["Countdown"] = HumanDuration(snap.Scheduled.Sub(now)).Clock()
+	}
+	// the clock script works from these rather than the formatted times so every client shows the same instant
+	data["StartedMillis"] = unixMillis(snap.Started)
+	data["ScheduledMillis"] = unixMillis(snap.Scheduled)
+	data["NowMillis"] = unixMillis(now)
+	data["ClockRate"] = race.clock.Rate()
+	data["Prizes"] = snap.Prizes
+	data["RaceName"] = config.RaceName
+	data["Distance"] = config.Distance
+	data["Role"] = requestRole(req.request)
+	data["CSRF"] = requestCSRF(req.request)
 	buf := tmplPool.Get()
 	defer tmplPool.Put(buf)
-	// comment out below four lines for performance!
-	raceResultsTemplate, err := template.New("template").Funcs(raceResultsFuncMap).ParseFiles("raceResults.template")
+	raceResultsTemplate, _, err := currentTemplates()
 	if err != nil {
 		return err
 	}
@@ -887,6 +1489,7 @@ func modifyEntryHandler(w http.ResponseWriter, r *http.Request, race *Race) {
 		showErrorForAdmin(w, r.Referer(), "%v", err)
 		return
 	}
+	race.raceEvent(actorOf(r), "modify entry", "place", place, "bib", entry.Bib, "fname", entry.Fname, "lname", entry.Lname, "duration", entry.Duration)
 	race.ConfirmTimeForBib(entry.Bib) //confirm all modified entries
 	http.Redirect(w, r, r.Referer(), 301)
 	return
@@ -894,6 +1497,9 @@ func modifyEntryHandler(w http.ResponseWriter, r *http.Request, race *Race) {
 
 type Race struct {
 	started             time.Time
+	scheduled           time.Time // when the race will start by itself, zero if it's not scheduled
+	startTimer          Timer     // fires at scheduled
+	events              *Broadcaster
 	startRaceChan       chan time.Time
 	optionalEntryFields []string
 	bibbedEntries       map[Bib]*Entry // map of Bib #s pointing to bibbed entries only, for link bib lookup
@@ -901,47 +1507,64 @@ type Race struct {
 	auditLog            []Audit        // A writeonly location to record the actions/events of the race
 	prizes              []Prize
 	optionalEmailIndex  int
+	lastConfirmed       Bib                          // the most recently confirmed finisher, shown on the finish screen
+	prized              int                          // prizes have been awarded to allEntries up to here
+	version             atomic.Uint64                // bumped by every Unlock, see Snapshot
+	modified            atomic.Int64                 // unix nanoseconds of the last Unlock, for Last-Modified
+	snapshot            atomic.Pointer[RaceSnapshot] // the latest snapshot, stale once version moves past it
+	snapshotLock        sync.Mutex                   // so only one request copies the race per version
+	links               rateCounter                  // bibs linked at the finish, for /metrics
+	writeWait           histogram                    // time spent waiting for Lock
+	readWait            histogram                    // time spent waiting for RLock
+	health              lockProbe                    // for /healthz
+	eventLog            *slog.Logger                 // every change to the race and who made it, nil for none
+	dirty               bool                         // changed since the lock was taken, see Unlock
+	entryCopies         []*Entry                     // allEntries' copies in the latest snapshot, nil where one changed since
+	clock               Clock                        // the race's time, fixed by NewRaceWithClock
 	sync.RWMutex
-	testingTime *time.Time //used only for testing -- if set, return time events from here, otherwise, pull time from syscall
 }
 
 func NewRace() *Race {
+	return NewRaceWithClock(RealClock)
+}
+
+// NewRaceWithClock makes a race that gets its time from clock, it can't change once the race is listening for racers
+func NewRaceWithClock(clock Clock) *Race {
 	start := make(chan time.Time)
-	go listenForRacers(start)
 	race := &Race{
 		startRaceChan:      start,
+		events:             NewBroadcaster(),
 		bibbedEntries:      make(map[Bib]*Entry),
 		allEntries:         make([]*Entry, 0, 1024),
 		auditLog:           make([]Audit, 0, 1024),
 		prizes:             make([]Prize, 0, 48),
 		optionalEmailIndex: -1, // initialize it to an invalid value
+		lastConfirmed:      NoBib,
+		clock:              clock,
 	}
-	log.Printf("Initialized the race")
+	go listenForRacers(start, clock.Now)
+	slog.Debug("Initialized the race")
 	return race
 }
 
 func (race *Race) GetTime() time.Time {
-	if race.testingTime == nil {
-		return time.Now()
-	}
-	return *race.testingTime
+	return race.clock.Now()
 }
 
 func (race *Race) WriteCSV(writer *csv.Writer) error {
-	race.Lock()
-	defer race.Unlock()
-	err := writer.Write(append(headers, race.optionalEntryFields...))
+	snap := race.Snapshot()
+	err := writer.Write(append(headers, snap.OptionalEntryFields...))
 	if err != nil {
 		return err
 	}
-	if !race.started.IsZero() {
-		timeStarted := []string{"", "", "", "", "", "", "", race.started.Format(time.ANSIC), ""}
-		err = writer.Write(append(timeStarted, race.optionalEntryFields...))
+	if !snap.Started.IsZero() {
+		timeStarted := []string{"", "", "", "", "", "", "", snap.Started.Format(time.ANSIC), ""}
+		err = writer.Write(append(timeStarted, snap.OptionalEntryFields...))
 		if err != nil {
 			return err
 		}
 	}
-	for place, entry := range race.allEntries {
+	for place, entry := range snap.Entries {
 		err = writer.Write(append([]string{entry.Fname, entry.Lname, strconv.Itoa(int(entry.Age)), gender(entry.Male), entry.Bib.String(), strconv.Itoa(place + 1), entry.Duration.String(), entry.TimeFinishedString(), fmt.Sprintf("%t", entry.Confirmed)}, entry.Optional...))
 		if err != nil {
 			return err
@@ -967,9 +1590,10 @@ func (race *Race) SetOptionalFields(of []string) error {
 	defer race.Unlock()
 	switch {
 	case len(race.allEntries) == 0:
+		race.changed()
 		race.optionalEntryFields = of
 		for x, fn := range race.optionalEntryFields {
-			if fn == config.emailField {
+			if fn == config.EmailField {
 				race.optionalEmailIndex = x
 				break
 			}
@@ -993,25 +1617,92 @@ func (race *Race) GetOptionalFields() []string {
 func (race *Race) SetPrizes(prizes []Prize) {
 	race.Lock()
 	defer race.Unlock()
+	race.changed()
 	race.prizes = prizes
-	recomputeAllPrizes(race.prizes, race.allEntries)
+	race.lockedRecomputePrizes()
 }
 
-func (race *Race) Start(t *time.Time) error { // optional time
+func (race *Race) Start(t *time.Time) error { // optional time, now if not given
 	race.Lock()
 	defer race.Unlock()
-	if !race.started.IsZero() && race.started != *t {
+	if t == nil {
+		now := race.GetTime()
+		t = &now
+	}
+	if !race.started.IsZero() {
+		if race.started.Equal(*t) {
+			return nil
+		}
 		return fmt.Errorf("Race is already started at - %s, can't start it at %s", race.started.Format(time.ANSIC), t.Format(time.ANSIC))
 	}
-	if t == nil {
-		race.started = race.GetTime()
-	} else {
-		race.started = *t
+	race.lockedStart(*t)
+	return nil
+}
+
+// lockedStart starts the race at the given instant, cancelling any scheduled start, and tells the clients
+func (race *Race) lockedStart(at time.Time) {
+	race.changed()
+	race.started = at
+	race.scheduled = time.Time{}
+	if race.startTimer != nil {
+		race.startTimer.Stop()
+		race.startTimer = nil
 	}
 	race.startRaceChan <- race.started
+	race.events.Publish("start", unixMillis(race.started))
+}
+
+// ScheduleStart starts the race by itself at the given time, replacing any earlier schedule, the race can still be
+// started early with Start
+func (race *Race) ScheduleStart(at time.Time) error {
+	race.Lock()
+	defer race.Unlock()
+	if !race.started.IsZero() {
+		return fmt.Errorf("Race is already started at - %s, can't schedule it", race.started.Format(time.ANSIC))
+	}
+	now := race.GetTime()
+	if !at.After(now) {
+		return fmt.Errorf("Scheduled start %s must be in the future", at.Format(time.ANSIC))
+	}
+	if race.startTimer != nil {
+		race.startTimer.Stop()
+	}
+	race.changed()
+	race.scheduled = at
+	race.startTimer = race.clock.AfterFunc(at.Sub(now), func() {
+		race.startScheduled(at)
+	})
+	slog.Info("Race scheduled", "at", at.Format("3:04:05"))
+	race.events.Publish("schedule", unixMillis(at))
+	return nil
+}
+
+func (race *Race) CancelScheduledStart() error {
+	race.Lock()
+	defer race.Unlock()
+	if race.scheduled.IsZero() {
+		return fmt.Errorf("Race start is not scheduled")
+	}
+	race.changed()
+	race.startTimer.Stop()
+	race.startTimer = nil
+	race.scheduled = time.Time{}
+	slog.Info("Scheduled race start cancelled")
+	race.events.Publish("schedule", unixMillis(race.scheduled))
 	return nil
 }
 
+// startScheduled starts the race at exactly the scheduled time, unless it was started early or rescheduled meanwhile
+func (race *Race) startScheduled(at time.Time) {
+	race.Lock()
+	defer race.Unlock()
+	if !race.started.IsZero() || !race.scheduled.Equal(at) {
+		return
+	}
+	race.lockedStart(at)
+	race.raceEvent("schedule", "start", "at", at)
+}
+
 func (race *Race) ModifyEntry(nonce string, place Place, mod Entry) error {
 	race.Lock()
 	defer race.Unlock()
@@ -1037,10 +1728,9 @@ func (race *Race) ModifyEntry(nonce string, place Place, mod Entry) error {
 		race.bibbedEntries[mod.Bib] = &mod
 	} else {
 		race.bibbedEntries[src.Bib] = src
-		return fmt.Errorf("Bib #%d already assigned to %s %s", mod.Bib, dest.Fname, dest.Lname)
+		return fmt.Errorf("Bib #%s already assigned to %s %s", mod.Bib, dest.Fname, dest.Lname)
 	}
-	race.lockedSortEntries()
-	recomputeAllPrizes(race.prizes, race.allEntries)
+	race.lockedUpdatePrizes(race.lockedReposition(race.allEntries[placeIndex]))
 	return nil
 }
 
@@ -1052,78 +1742,222 @@ func (rh RaceHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 var globalRace *Race // only used in/from main(), not from testing
 
-func init() {
-	globalRace = NewRace()
-	http.Handle(config.webserverHostname+"/", RaceHandler(handler))
-	http.Handle(config.webserverHostname+"/dayof", RaceHandler(handler))
-	http.Handle(config.webserverHostname+"/admin", RaceHandler(handler))
-	http.Handle(config.webserverHostname+"/start", RaceHandler(startHandler))
-	http.Handle(config.webserverHostname+"/linkBib", RaceHandler(linkBibHandler))
-	http.Handle(config.webserverHostname+"/addEntry", RaceHandler(addEntryHandler))
-	http.Handle(config.webserverHostname+"/modifyEntry", RaceHandler(modifyEntryHandler))
-	http.Handle(config.webserverHostname+"/download", RaceHandler(downloadHandler))
-	http.Handle(config.webserverHostname+"/uploadRacers", RaceHandler(uploadRacersHandler))
-	http.Handle(config.webserverHostname+"/uploadPrizes", RaceHandler(uploadPrizesHandler))
-	http.Handle(config.webserverHostname+"/static/", http.StripPrefix("/static/", http.FileServer(http.Dir("static/"))))
-	http.Handle(config.webserverHostname+"/fonts/", http.StripPrefix("/fonts/", http.FileServer(http.Dir("fonts/"))))
-	http.Handle("/", http.RedirectHandler("http://"+config.webserverHostname+"/", 307))
+// registerHandlers sets up the app's routes, hostRouter decides which hosts they're served on
+func registerHandlers() {
+	handle("/", authorizePage(RaceHandler(handler)))
+	handle("/login", authorize(RolePublic, RaceHandler(loginHandler)))
+	handle("/logout", http.HandlerFunc(logoutHandler))
+	handle("/ca.crt", http.HandlerFunc(caHandler))
+	handle("/dayof", authorize(RoleRegistration, RaceHandler(handler)))
+	handle("/admin", authorize(RoleAdmin, RaceHandler(handler)))
+	handle("/scanner", authorize(RoleTimer, RaceHandler(handler)))
+	handle("/audit", authorize(RoleAdmin, RaceHandler(handler)))
+	handle("/search", authorize(RolePublic, RaceHandler(handler)))
+	handle("/runner/", authorize(RolePublic, RaceHandler(runnerHandler)))
+	handle("/bibs", authorize(RoleAdmin, RaceHandler(bibLabelsHandler)))
+	handle("/bibs/", authorize(RoleAdmin, RaceHandler(bibLabelsHandler)))
+	handle("/start", mutation(RoleTimer, RaceHandler(startHandler)))
+	handle("/scheduleStart", mutation(RoleTimer, RaceHandler(scheduleStartHandler)))
+	handle("/adjustStart", mutation(RoleAdmin, RaceHandler(adjustStartHandler)))
+	handle("/startAt", mutation(RoleAdmin, RaceHandler(startAtHandler)))
+	http.Handle("/events", authorize(RolePublic, RaceHandler(eventsHandler)))
+	handle("/linkBib", mutation(RoleTimer, RaceHandler(linkBibHandler)))
+	handle("/addEntry", mutation(RoleRegistration, RaceHandler(addEntryHandler)))
+	handle("/modifyEntry", mutation(RoleAdmin, RaceHandler(modifyEntryHandler)))
+	handle("/download", authorize(RoleAdmin, RaceHandler(downloadHandler)))
+	handle("/uploadRacers", mutation(RoleAdmin, RaceHandler(uploadRacersHandler)))
+	handle("/uploadPrizes", mutation(RoleAdmin, RaceHandler(uploadPrizesHandler)))
+	handle("/queues", authorize(RoleAdmin, http.HandlerFunc(queuesHandler)))
+	http.Handle("/healthz", RaceHandler(healthzHandler))
+	http.Handle("/metrics", RaceHandler(metricsHandler))
+	handle("/static/", staticHandler("/static/", config.staticFS()))
+	handle("/fonts/", staticHandler("/fonts/", config.fontsFS()))
+}
+
+func loadDefaultPrizes() {
 	req, err := uploadFile("prizes.json")
 	if err == nil {
 		resp := httptest.NewRecorder()
 		uploadPrizesHandler(resp, req, globalRace)
 		if resp.Code != 301 {
-			log.Println("Unable to load the default prizes.json file.")
+			slog.Warn("Unable to load the default prizes.json file")
 		}
 	} else {
-		log.Printf("Unable to load the default prizes.json file - %v\n", err)
+		slog.Warn("Unable to load the default prizes.json file", "err", err)
 	}
 }
 
 func main() {
-	log.Printf("Starting http server")
-	listener, err := net.Listen("tcp", ":80")
+	if len(os.Args) >= 3 && os.Args[1] == "config" && os.Args[2] == "check" {
+		if err := checkConfig(os.Stdout, os.Args[3:]); err != nil {
+			fmt.Fprintf(os.Stderr, "Configuration invalid!\n%s\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	err := LoadConfig(&config, os.Args[1:])
+	if err == flag.ErrHelp {
+		return
+	}
+	if err != nil {
+		fatal("Error loading config", "err", err)
+	}
+	if err = config.Validate(); err != nil {
+		fatal("Configuration invalid, run racergo config check for details", "err", err)
+	}
+	if err = setupLogging(config); err != nil {
+		fatal("Error setting up logging", "err", err)
+	}
+	if err = os.MkdirAll(config.DataDir, 0755); err != nil {
+		fatal("Error creating data directory", "err", err)
+	}
+	eventLog, eventLogFile, err := openEventLog(config.eventLogFile())
 	if err != nil {
-		log.Printf("Error listening on port 80, trying 8080 instead! - %s\n", err)
-		listener, err = net.Listen("tcp", ":8080")
+		fatal("Error opening the race event log", "err", err)
+	}
+	defer eventLogFile.Close()
+	clock := RealClock
+	if config.Rehearsal > 0 && config.Rehearsal != 1 {
+		clock = NewAcceleratedClock(config.Rehearsal)
+		slog.Warn("Rehearsing, the race clock is running faster than real time", "rate", config.Rehearsal)
+	}
+	globalRace = NewRaceWithClock(clock)
+	globalRace.eventLog = eventLog
+	if err = loadTemplates(); err != nil {
+		fatal("Error loading templates", "err", err)
+	}
+	registerHandlers()
+	loadDefaultPrizes()
+	if config.DNSAddr != "" {
+		go serveDNS()
+	}
+	slog.Info("Starting http server")
+	listener, err := net.Listen("tcp", config.HTTPAddr)
+	if err != nil && config.HTTPAddr == defaultHTTPAddr {
+		slog.Warn("Error listening, trying the fallback", "addr", config.HTTPAddr, "fallback", fallbackHTTPAddr, "err", err)
+		listener, err = net.Listen("tcp", fallbackHTTPAddr)
 		if err != nil {
-			log.Fatalf("Error listening on port 8080! - %s\n", err)
+			fatal("Error listening", "addr", fallbackHTTPAddr, "err", err)
 			return
 		}
-	} else {
-		go func() {
-			log.Fatal(http.ListenAndServeTLS(":443", "racergo.cert", "racergo.key", nil))
-		}()
+	} else if err != nil {
+		fatal("Error listening", "addr", config.HTTPAddr, "err", err)
+		return
+	}
+	servers := []*http.Server{{}}
+	if config.HTTPSAddr != "" {
+		servers = append(servers, &http.Server{Addr: config.HTTPSAddr})
 	}
 	port := strings.Split(listener.Addr().String(), ":")
 	portNum := port[len(port)-1]
-	log.Printf("Basic - http://%s:%s", config.webserverHostname, portNum)
-	log.Printf("Admin - http://%s:%s/admin", config.webserverHostname, portNum)
-	log.Printf("Audit - http://%s:%s/audit", config.webserverHostname, portNum)
-	log.Printf("Dayof - http://%s:%s/dayof", config.webserverHostname, portNum)
-	log.Printf("Mobile Scanner Linker - http://%s:%s/linkBib?bib=%%s&scanned=true", config.webserverHostname, portNum)
-	log.Printf("Large Screen Live Results - http://%s:%s/results", config.webserverHostname, portNum)
-	err = http.Serve(listener, nil)
+	if config.MDNS {
+		httpPort, _ := strconv.Atoi(portNum)
+		advertiseMDNS(httpPort)
+	}
+	base := fmt.Sprintf("http://%s:%s", config.WebserverHostname, portNum)
+	for _, page := range []struct{ name, path string }{
+		{"Basic", ""},
+		{"Admin", "/admin"},
+		{"Audit", "/audit"},
+		{"Dayof", "/dayof"},
+		{"Runner Lookup", "/search"},
+		{"Printable Bib Labels", "/bibs?from=1&to=100"},
+		{"Mobile Scanner Linker", "/scanner"},
+		{"Large Screen Live Results", "/results"},
+		{"Certificate Authority for phones", "/ca.crt"},
+	} {
+		slog.Info(page.name, "url", base+page.path)
+	}
+	if config.adminTokenGenerated() {
+		slog.Info("Login", "url", base+"/login", "adminToken", config.AdminToken)
+	} else {
+		slog.Info("Login", "url", base+"/login")
+	}
+	if config.AcceptIPs {
+		for _, ip := range lanIPs() {
+			if !ip.IsLoopback() {
+				slog.Info("Without DNS", "url", "http://"+net.JoinHostPort(ip.String(), portNum))
+			}
+		}
+	}
+	for _, srv := range servers {
+		srv.RegisterOnShutdown(globalRace.events.Close) // the event streams never finish by themselves
+	}
+	app := gzipHandler(hostRouter(prioritize(http.DefaultServeMux)))
+	servers[0].Handler = app
+	if len(servers) > 1 {
+		servers[1].Handler = app
+		if config.RedirectHTTPS {
+			servers[0].Handler = redirectHTTPS(config.HTTPSAddr, servers[0].Handler)
+		}
+		go serveHTTPS(servers[1])
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		err := servers[0].Serve(listener)
+		if err != http.ErrServerClosed {
+			fatal("Error starting http server", "err", err)
+		}
+	}()
+	<-ctx.Done()
+	stop() // a second Ctrl-C kills racergo right away
+	if err = shutdown(servers, globalRace, emails); err != nil {
+		fatal("Error shutting down", "err", err)
+	}
+	slog.Info("Shut down cleanly")
+}
+
+// serveHTTPS serves the same handlers over https, generating a certificate if none is configured
+// racergo keeps running on http if https can't start
+func serveHTTPS(srv *http.Server) {
+	certFile, keyFile := config.TLSCert, config.TLSKey
+	if certFile == "" {
+		var err error
+		names, ips := certHosts()
+		certFile, keyFile, err = ensureCertificate(config.DataDir, names, ips)
+		if err != nil {
+			slog.Error("Error generating https certificate, serving http only", "err", err)
+			return
+		}
+	}
+	slog.Info("Starting https server", "addr", config.HTTPSAddr)
+	listener, err := net.Listen("tcp", config.HTTPSAddr)
 	if err != nil {
-		log.Fatalf("Error starting http server! - %s\n", err)
+		slog.Error("Error listening, serving http only", "addr", config.HTTPSAddr, "err", err)
+		return
+	}
+	httpsServing.Store(true)
+	err = srv.ServeTLS(listener, certFile, keyFile)
+	httpsServing.Store(false)
+	if err != http.ErrServerClosed {
+		slog.Error("Error serving https, serving http only", "addr", config.HTTPSAddr, "err", err)
 	}
 }
 
-func listenForRacers(raceStarter chan time.Time) {
+// listenForRacers logs the race clock, now is the race's time since the ticker's is real time
+func listenForRacers(raceStarter chan time.Time, now func() time.Time) {
 	ticker := time.NewTicker(time.Second * 10)
 	var start time.Time
 	raceHasStarted := false
 	for {
 		select {
 		case start = <-raceStarter:
-			ticker.Stop() // stop and "upgrade" the ticker for every second to track time
+			ticker.Stop()
+			if start.IsZero() { // reset after a false start
+				ticker = time.NewTicker(time.Second * 10)
+				raceHasStarted = false
+				continue
+			}
+			// "upgrade" the ticker for every second to track time
 			ticker = time.NewTicker(time.Second)
-			log.Printf("Race started @ %s\n", start.Format("3:04:05"))
+			slog.Info("Race started", "at", start.Format("3:04:05.00"))
 			raceHasStarted = true
-		case now := <-ticker.C:
+		case <-ticker.C:
 			if raceHasStarted {
-				log.Println(HumanDuration(now.Sub(start)))
+				slog.Debug("Race clock", "time", HumanDuration(now().Sub(start)))
 			} else {
-				log.Println("Waiting to start the race")
+				slog.Debug("Waiting to start the race")
 			}
 			// update the clock
 		}
@@ -4,12 +4,17 @@ import (
 	"bytes"
 	"encoding/csv"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"log"
+	"math/rand"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
 	"reflect"
 	"runtime"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
@@ -29,7 +34,7 @@ func modifyTestEntry(race *Race, t *testing.T, place Place, e *Entry, optionalEn
 	race.Lock()
 	values.Add("Nonce", race.allEntries[place-1].Nonce())
 	race.Unlock()
-	values.Add("Bib", strconv.Itoa(int(e.Bib)))
+	values.Add("Bib", e.Bib.String())
 	values.Add("Age", strconv.Itoa(int(e.Age)))
 	values.Add("Fname", e.Fname)
 	values.Add("Lname", e.Lname)
@@ -51,7 +56,7 @@ func modifyTestEntry(race *Race, t *testing.T, place Place, e *Entry, optionalEn
 
 func addTestEntry(race *Race, t *testing.T, e *Entry, optionalEntryFields []string) {
 	values := make(url.Values)
-	values.Add("Bib", strconv.Itoa(int(e.Bib)))
+	values.Add("Bib", e.Bib.String())
 	values.Add("Age", strconv.Itoa(int(e.Age)))
 	values.Add("Fname", e.Fname)
 	values.Add("Lname", e.Lname)
@@ -76,9 +81,8 @@ func downloadUploadCompareDownload(t *testing.T, race *Race) {
 		t.Errorf("Error writing temp audit upload file - %v", err)
 		return
 	}
-	tempRace := NewRace()
+	tempRace := NewRaceWithClock(race.clock)
 	tempRace.Start(&race.started)
-	tempRace.testingTime = race.testingTime
 	testUploadRacersHelper(t, "auditUploadTemp", http.StatusMovedPermanently, tempRace)
 
 	got := downloadCurrent(t, tempRace)
@@ -90,10 +94,9 @@ func downloadUploadCompareDownload(t *testing.T, race *Race) {
 }
 
 func TestDownloadAndAudit(t *testing.T) {
-	race := NewRace()
 	raceStart := time.Now().Add(-time.Hour).Round(time.Second)
-	race.testingTime = &time.Time{}
-	*race.testingTime = raceStart
+	clock := NewManualClock(raceStart)
+	race := NewRaceWithClock(clock)
 	startRace(race)
 	optionalEntryFields := []string{"Email", "T-Shirt"}
 	if err := race.SetOptionalFields(optionalEntryFields); err != nil {
@@ -101,10 +104,10 @@ func TestDownloadAndAudit(t *testing.T) {
 	}
 
 	users := []Entry{
-		Entry{1, "A", "B", true, 15, []string{"userA@host.com", "Large"}, HumanDuration(time.Second), raceStart.Add(time.Second), true},
-		Entry{2, "C", "D", false, 25, []string{"userC@host.com", "Medium"}, HumanDuration(time.Minute), raceStart.Add(time.Minute), true},
-		Entry{3, "E", "F", true, 30, []string{"userE@host.com", "Small"}, HumanDuration(time.Hour), raceStart.Add(time.Hour), true},
-		Entry{4, "G", "H", false, 35, []string{"userG@host.com", "XSmall"}, HumanDuration(time.Millisecond * 10), raceStart.Add(time.Millisecond * 10), true},
+		Entry{"1", "A", "B", true, 15, []string{"userA@host.com", "Large"}, HumanDuration(time.Second), raceStart.Add(time.Second), true},
+		Entry{"2", "C", "D", false, 25, []string{"userC@host.com", "Medium"}, HumanDuration(time.Minute), raceStart.Add(time.Minute), true},
+		Entry{"3", "E", "F", true, 30, []string{"userE@host.com", "Small"}, HumanDuration(time.Hour), raceStart.Add(time.Hour), true},
+		Entry{"4", "G", "H", false, 35, []string{"userG@host.com", "XSmall"}, HumanDuration(time.Millisecond * 10), raceStart.Add(time.Millisecond * 10), true},
 	}
 	for _, u := range users {
 		addTestEntry(race, t, &u, optionalEntryFields)
@@ -120,25 +123,25 @@ G,H,35,F,4,4,--,--,false,userG@host.com,XSmall
 		raceStart.Format(time.ANSIC),
 	))
 	// link bibs, then validate
-	*race.testingTime = raceStart.Add(time.Millisecond * 10)
-	linkBibTesting(t, race, 4, false, false)
+	clock.Set(raceStart.Add(time.Millisecond * 10))
+	linkBibTesting(t, race, "4", false, false)
 	downloadUploadCompareDownload(t, race)
-	linkBibTesting(t, race, 4, false, true)
+	linkBibTesting(t, race, "4", false, true)
 	downloadUploadCompareDownload(t, race)
-	*race.testingTime = raceStart.Add(time.Second)
-	linkBibTesting(t, race, 1, false, false)
+	clock.Set(raceStart.Add(time.Second))
+	linkBibTesting(t, race, "1", false, false)
 	downloadUploadCompareDownload(t, race)
-	linkBibTesting(t, race, 1, false, true)
+	linkBibTesting(t, race, "1", false, true)
 	downloadUploadCompareDownload(t, race)
-	*race.testingTime = raceStart.Add(time.Minute)
-	linkBibTesting(t, race, 2, false, false)
+	clock.Set(raceStart.Add(time.Minute))
+	linkBibTesting(t, race, "2", false, false)
 	downloadUploadCompareDownload(t, race)
-	linkBibTesting(t, race, 2, false, true)
+	linkBibTesting(t, race, "2", false, true)
 	downloadUploadCompareDownload(t, race)
-	*race.testingTime = raceStart.Add(time.Hour)
-	linkBibTesting(t, race, 3, false, false)
+	clock.Set(raceStart.Add(time.Hour))
+	linkBibTesting(t, race, "3", false, false)
 	downloadUploadCompareDownload(t, race)
-	linkBibTesting(t, race, 3, false, true)
+	linkBibTesting(t, race, "3", false, true)
 	downloadUploadCompareDownload(t, race)
 
 	validateDownload(t, race, 2, fmt.Sprintf(`Fname,Lname,Age,Gender,Bib,Overall Place,Duration,Time Finished,Confirmed,Email,T-Shirt
@@ -156,9 +159,8 @@ E,F,30,M,3,4,01:00:00.00,%s,true,userE@host.com,Small
 	))
 	downloadUploadCompareDownload(t, race)
 	// now upload modified results in a new race
-	race = NewRace()
-	race.testingTime = &time.Time{}
-	*race.testingTime = raceStart
+	clock = NewManualClock(raceStart)
+	race = NewRaceWithClock(clock)
 	startRace(race)
 	if err := ioutil.WriteFile("auditUploadTemp", []byte(fmt.Sprintf(`Fname,Lname,Age,Gender,Bib,Overall Place,Duration,Time Finished,Confirmed,Email,T-Shirt
 ,,,,,,,%s,,Email,T-Shirt
@@ -189,15 +191,15 @@ G,H,35,F,4,4,--,--,false,userG@host.com,GT
 	downloadUploadCompareDownload(t, race)
 
 	// link them again
-	*race.testingTime = raceStart.Add(time.Millisecond * 10 * 2)
-	linkBibTesting(t, race, 2, false, false)
+	clock.Set(raceStart.Add(time.Millisecond * 10 * 2))
+	linkBibTesting(t, race, "2", false, false)
 	downloadUploadCompareDownload(t, race)
-	linkBibTesting(t, race, 2, false, true)
+	linkBibTesting(t, race, "2", false, true)
 	downloadUploadCompareDownload(t, race)
-	*race.testingTime = raceStart.Add(time.Minute * 2)
-	linkBibTesting(t, race, 4, false, false)
+	clock.Set(raceStart.Add(time.Minute * 2))
+	linkBibTesting(t, race, "4", false, false)
 	downloadUploadCompareDownload(t, race)
-	linkBibTesting(t, race, 4, false, true)
+	linkBibTesting(t, race, "4", false, true)
 	downloadUploadCompareDownload(t, race)
 
 	validateDownload(t, race, 4, fmt.Sprintf(`Fname,Lname,Age,Gender,Bib,Overall Place,Duration,Time Finished,Confirmed,Email,T-Shirt
@@ -217,7 +219,7 @@ E,F,30,M,3,4,01:00:00.00,%s,true,userE@host.com,ET
 
 	moddedEntry := &Entry{
 		Age:      10,
-		Bib:      5,
+		Bib:      "5",
 		Fname:    "I",
 		Lname:    "J",
 		Male:     false,
@@ -245,13 +247,13 @@ E,F,30,M,3,4,01:00:00.00,%s,true,userE@host.com,ET
 	))
 }
 
-func linkBibTesting(t *testing.T, race *Race, bib int, remove, confirm bool) {
+func linkBibTesting(t *testing.T, race *Race, bib string, remove, confirm bool) {
 	req, err := http.NewRequest("post", "", nil)
 	if err != nil {
 		t.Errorf("Unexpected error - %v", err)
 	}
 	req.ParseForm()
-	req.Form.Set("bib", strconv.Itoa(bib))
+	req.Form.Set("bib", bib)
 	if remove {
 		req.Form.Set("remove", "true")
 	}
@@ -261,7 +263,7 @@ func linkBibTesting(t *testing.T, race *Race, bib int, remove, confirm bool) {
 	w := httptest.NewRecorder()
 	linkBibHandler(w, req, race)
 	if w.Code != http.StatusMovedPermanently {
-		t.Errorf("%d - Expected redirect, got %v - %s", bib, w.Code, w.Body)
+		t.Errorf("%s - Expected redirect, got %v - %s", bib, w.Code, w.Body)
 	}
 }
 
@@ -307,8 +309,8 @@ NextExpected:
 
 func TestRestoreTime(t *testing.T) {
 	now := time.Now().Round(time.Second)
-	race := NewRace()
-	race.testingTime = &now
+	clock := NewManualClock(now)
+	race := NewRaceWithClock(clock)
 	want := fmt.Sprintf("%s\n", strings.Join(headers, ","))
 	got := downloadCurrent(t, race)
 	f, err := ioutil.TempFile("/tmp", "racergorestoretime")
@@ -330,11 +332,12 @@ func TestRestoreTime(t *testing.T) {
 		Lname: "z",
 		Age:   34,
 		Male:  true,
-		Bib:   1,
+		Bib:   "1",
 	})
-	*race.testingTime = race.testingTime.Add(time.Minute)
-	race.RecordTimeForBib(1)
-	race.ConfirmTimeForBib(1)
+	now = now.Add(time.Minute)
+	clock.Set(now)
+	race.RecordTimeForBib("1")
+	race.ConfirmTimeForBib("1")
 	want = fmt.Sprintf("%s\n,,,,,,,%s,\nmatt,z,34,M,1,1,00:01:00.00,%s,true\n", strings.Join(headers, ","), now.Add(-time.Minute).Format(time.ANSIC), now.Format(time.ANSIC))
 	got = downloadCurrent(t, race)
 	f, err = ioutil.TempFile("/tmp", "racergorestoretime")
@@ -351,9 +354,7 @@ func TestRestoreTime(t *testing.T) {
 	}
 
 	// upload a non-started race output
-	race = NewRace()
-	race.testingTime = &time.Time{}
-	*race.testingTime = now.Add(10 * time.Second)
+	race = NewRaceWithClock(NewManualClock(now.Add(10 * time.Second)))
 	testUploadRacersHelper(t, nonStartedOutput, 409, race)
 	race.Lock()
 	if !race.started.IsZero() {
@@ -362,9 +363,7 @@ func TestRestoreTime(t *testing.T) {
 	race.Unlock()
 
 	// upload a started race output
-	race = NewRace()
-	race.testingTime = &time.Time{}
-	*race.testingTime = now.Add(10 * time.Second)
+	race = NewRaceWithClock(NewManualClock(now.Add(10 * time.Second)))
 	testUploadRacersHelper(t, startedOutput, 301, race)
 	race.Lock()
 	now = now.Add(-time.Minute)
@@ -434,7 +433,7 @@ func TestRescoreOnChange(t *testing.T) {
 	if err := race.AddEntry(Entry{
 		Fname: "A",
 		Lname: "A",
-		Bib:   1,
+		Bib:   "1",
 		Age:   15,
 		Male:  true,
 	}); err != nil {
@@ -443,23 +442,23 @@ func TestRescoreOnChange(t *testing.T) {
 	if err := race.AddEntry(Entry{
 		Fname: "B",
 		Lname: "B",
-		Bib:   2,
+		Bib:   "2",
 		Age:   15,
 		Male:  true,
 	}); err != nil {
 		t.Errorf("Error adding entry - %v", err)
 	}
 	race.Start(&now)
-	if err := race.RecordTimeForBib(1); err != nil {
+	if err := race.RecordTimeForBib("1"); err != nil {
 		t.Errorf("Error linking bib - %v", err)
 	}
-	if err := race.ConfirmTimeForBib(1); err != nil {
+	if err := race.ConfirmTimeForBib("1"); err != nil {
 		t.Errorf("Error linking bib - %v", err)
 	}
-	if err := race.RecordTimeForBib(2); err != nil {
+	if err := race.RecordTimeForBib("2"); err != nil {
 		t.Errorf("Error linking bib - %v", err)
 	}
-	if err := race.ConfirmTimeForBib(2); err != nil {
+	if err := race.ConfirmTimeForBib("2"); err != nil {
 		t.Errorf("Error linking bib - %v", err)
 	}
 	race.RLock()
@@ -575,6 +574,7 @@ func TestTemplates(t *testing.T) {
 		"/audit",
 		"/results",
 		"/admin",
+		"/scanner",
 	}
 	for _, u := range urls {
 		w := httptest.NewRecorder()
@@ -591,10 +591,10 @@ func TestTemplates(t *testing.T) {
 		t.Errorf("Nil expected, got %v", err)
 	}
 	users := []Entry{
-		Entry{-1, "A", "B", true, 15, []string{"userA@host.com", "Large"}, 0, time.Time{}, true},
-		Entry{-1, "C", "D", false, 25, []string{"userC@host.com", "Medium"}, 0, time.Time{}, true},
-		Entry{-1, "E", "F", true, 30, []string{"userE@host.com", "Small"}, 0, time.Time{}, true},
-		Entry{5, "G", "H", false, 35, []string{"userG@host.com", "XSmall"}, 0, time.Time{}, true},
+		Entry{NoBib, "A", "B", true, 15, []string{"userA@host.com", "Large"}, 0, time.Time{}, true},
+		Entry{NoBib, "C", "D", false, 25, []string{"userC@host.com", "Medium"}, 0, time.Time{}, true},
+		Entry{NoBib, "E", "F", true, 30, []string{"userE@host.com", "Small"}, 0, time.Time{}, true},
+		Entry{"5", "G", "H", false, 35, []string{"userG@host.com", "XSmall"}, 0, time.Time{}, true},
 	}
 	for _, u := range users {
 		t.Logf("Adding entry - %v", u)
@@ -620,10 +620,10 @@ func TestTemplates(t *testing.T) {
 		}
 	}
 	users = []Entry{
-		Entry{1, "H", "I", true, 15, []string{"userA@host.com", "Large"}, 0, time.Time{}, true},
-		Entry{2, "J", "K", false, 25, []string{"userC@host.com", "Medium"}, 0, time.Time{}, true},
-		Entry{3, "L", "M", true, 30, []string{"userE@host.com", "Small"}, 0, time.Time{}, true},
-		Entry{4, "N", "O", false, 35, []string{"userG@host.com", "XSmall"}, 0, time.Time{}, true},
+		Entry{"1", "H", "I", true, 15, []string{"userA@host.com", "Large"}, 0, time.Time{}, true},
+		Entry{"2", "J", "K", false, 25, []string{"userC@host.com", "Medium"}, 0, time.Time{}, true},
+		Entry{"3", "L", "M", true, 30, []string{"userE@host.com", "Small"}, 0, time.Time{}, true},
+		Entry{"4", "N", "O", false, 35, []string{"userG@host.com", "XSmall"}, 0, time.Time{}, true},
 	}
 	for _, u := range users {
 		t.Logf("Adding entry - %v", u)
@@ -660,26 +660,26 @@ func TestLink(t *testing.T) { // includes removing of racers
 		remove    bool
 		scanned   bool
 	}{
-		{1, 0, 409, false, false, false}, // no bib #0 in test_runners.csv
-		{1, 1, 301, false, false, false},
-		{1, 1, 301, false, true, false},
-		{1, 1, 409, false, true, false},
-		{1, 1, 301, false, false, false},
-		{2, 2, 301, false, false, false},
-		{2, 2, 301, false, true, false},
-		{2, 2, 301, false, false, false},
-		{3, 3, 301, false, false, false},
-		{4, 4, 301, false, false, false},
-		{3, 3, 301, false, true, false},  // remove bib 3 from place 3
-		{4, 3, 301, false, false, false}, // re-add 3 which will swap their positions
-		{5, 5, 301, false, false, false},
-		{6, 6, 301, false, false, false},
-		{1, 1, 301, true, false, true},
-		{2, 2, 301, true, false, true},
-		{4, 3, 301, true, false, true},
-		{3, 4, 301, true, false, true},
-		{5, 5, 301, true, false, true},
-		{6, 6, 301, true, false, true},
+		{1, "0", 409, false, false, false}, // no bib #0 in test_runners.csv
+		{1, "1", 301, false, false, false},
+		{1, "1", 301, false, true, false},
+		{1, "1", 409, false, true, false},
+		{1, "1", 301, false, false, false},
+		{2, "2", 301, false, false, false},
+		{2, "2", 301, false, true, false},
+		{2, "2", 301, false, false, false},
+		{3, "3", 301, false, false, false},
+		{4, "4", 301, false, false, false},
+		{3, "3", 301, false, true, false},  // remove bib 3 from place 3
+		{4, "3", 301, false, false, false}, // re-add 3 which will swap their positions
+		{5, "5", 301, false, false, false},
+		{6, "6", 301, false, false, false},
+		{1, "1", 301, true, false, true},
+		{2, "2", 301, true, false, true},
+		{4, "3", 301, true, false, true},
+		{3, "4", 301, true, false, true},
+		{5, "5", 301, true, false, true},
+		{6, "6", 301, true, false, true},
 	}
 	for i, x := range tableTests {
 		t.Logf("Iteration %d", i)
@@ -688,7 +688,7 @@ func TestLink(t *testing.T) { // includes removing of racers
 			t.Errorf("Unexpected error - %v", err)
 		}
 		req.ParseForm()
-		req.Form.Set("bib", strconv.Itoa(int(x.bib)))
+		req.Form.Set("bib", string(x.bib))
 		if x.remove {
 			req.Form.Set("remove", "true")
 		}
@@ -700,7 +700,7 @@ func TestLink(t *testing.T) { // includes removing of racers
 		if x.code != w.Code {
 			t.Errorf("Iteration - %d, Expected %d, got %d - %s", i, x.code, w.Code, w.Body.Bytes())
 		}
-		if x.bib <= 0 || x.remove {
+		if x.code != 301 || x.remove {
 			continue
 		}
 		race.RLock()
@@ -751,7 +751,7 @@ func TestPrizes(t *testing.T) {
 			t.Fatalf("Unexpected nil request")
 		}
 		req.ParseForm()
-		req.Form.Set("bib", strconv.Itoa(int(entry.Bib)))
+		req.Form.Set("bib", string(entry.Bib))
 		w = httptest.NewRecorder()
 		linkBibHandler(w, req, race)
 		if w.Code != 301 {
@@ -865,6 +865,70 @@ func TestSortResults(t *testing.T) {
 	}
 }
 
+func TestParseBib(t *testing.T) {
+	for val, want := range map[string]Bib{"7": "7", "007": "7", "0": "0", "000": "0", "K07": "K07", " k12 ": "K12", "1001a": "1001A", "": NoBib, "--": NoBib, "R-3": "R-3"} {
+		if got, err := ParseBib(val); err != nil || got != want {
+			t.Errorf("%q - expected %q, got %q %v", val, want, got, err)
+		}
+	}
+	for _, val := range []string{"12 B", "<b>", "12345678901234567"} {
+		if _, err := ParseBib(val); err == nil {
+			t.Errorf("%q - expected an error", val)
+		}
+	}
+	if a, b := mustParseBib(t, "007"), mustParseBib(t, "7"); a != b {
+		t.Errorf("Expected a zero padded bib to be the same runner, got %q and %q", a, b)
+	}
+	if a, b := mustParseBib(t, "007A"), mustParseBib(t, "7A"); a == b || a.Compare(b) == 0 || b.Compare(a) != -a.Compare(b) {
+		t.Errorf("Expected %q and %q to be different runners in a fixed order, got %d", a, b, a.Compare(b))
+	}
+	bibs := []Bib{"K10", "10", "1001B", "K2", "9", "A", "1001A", "100", "K02"}
+	slices.SortFunc(bibs, Bib.Compare)
+	if want := []Bib{"9", "10", "100", "1001A", "1001B", "A", "K02", "K2", "K10"}; !slices.Equal(bibs, want) {
+		t.Errorf("Expected bibs in natural order %v, got %v", want, bibs)
+	}
+}
+
+func mustParseBib(t *testing.T, val string) Bib {
+	bib, err := ParseBib(val)
+	if err != nil {
+		t.Fatalf("Error parsing bib %q - %v", val, err)
+	}
+	return bib
+}
+
+func TestAlphanumericBibs(t *testing.T) {
+	clock := NewManualClock(time.Now().Truncate(time.Second)) // the start is exported to the second
+	race := NewRaceWithClock(clock)
+	if !testUploadRacersHelper(t, "test_alpha_bibs.csv", 301, race) {
+		t.FailNow()
+	}
+	startRace(race)
+	race.RLock()
+	var order []Bib
+	for _, entry := range race.allEntries {
+		order = append(order, entry.Bib)
+	}
+	race.RUnlock()
+	if want := []Bib{"9", "10", "1001A", "1001B", "K2", "K12"}; !slices.Equal(order, want) {
+		t.Errorf("Expected the unfinished sorted by bib %v, got %v", want, order)
+	}
+	for _, bib := range []string{"k12", "1001a"} {
+		clock.Advance(time.Minute)
+		linkBibTesting(t, race, bib, false, true)
+	}
+	if result, ok := race.Snapshot().Runner("K12"); !ok || result.Place != 1 || !result.Confirmed {
+		t.Errorf("Expected K12 to have finished first, got %#v", result)
+	}
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/search?q=1001a", nil)
+	handler(w, r, race)
+	if !strings.Contains(w.Body.String(), "Leg A") || strings.Contains(w.Body.String(), "Leg B") {
+		t.Errorf("Expected a bib search to find only that bib - %s", w.Body.String())
+	}
+	downloadUploadCompareDownload(t, race)
+}
+
 func TestHumanDuration(t *testing.T) {
 	tests := []struct {
 		duration HumanDuration
@@ -896,3 +960,253 @@ func TestHumanDuration(t *testing.T) {
 		}
 	}
 }
+
+func TestSearch(t *testing.T) {
+	clock := NewManualClock(time.Now())
+	race := NewRaceWithClock(clock)
+	req, err := uploadFile("test_prizes.json")
+	if err != nil {
+		t.Fatalf("Unexpected error - %v", err)
+	}
+	w := httptest.NewRecorder()
+	uploadPrizesHandler(w, req, race)
+	if w.Code != 301 {
+		t.Errorf("Expected redirect, got %d", w.Code)
+	}
+	for _, e := range []Entry{
+		{Bib: "1", Fname: "Matthew", Lname: "Zimmerman", Age: 34, Male: true},
+		{Bib: "2", Fname: "Sarah", Lname: "Smith", Age: 28},
+		{Bib: "3", Fname: "Samuel", Lname: "Smyth", Age: 31, Male: true},
+		{Bib: "14", Fname: "Jane", Lname: "Doe", Age: 9},
+	} {
+		if err := race.AddEntry(e); err != nil {
+			t.Fatalf("Error adding entry - %v", err)
+		}
+	}
+	startRace(race)
+	for _, bib := range []Bib{"3", "2", "1"} {
+		clock.Advance(time.Minute)
+		if err := race.RecordTimeForBib(bib); err != nil {
+			t.Errorf("Error linking bib - %v", err)
+		}
+		if err := race.ConfirmTimeForBib(bib); err != nil {
+			t.Errorf("Error confirming bib - %v", err)
+		}
+	}
+	tests := []struct {
+		query string
+		bibs  []Bib
+	}{
+		{"", nil},
+		{"14", []Bib{"14"}},
+		{"smith", []Bib{"2", "3"}}, // Smyth is one edit away
+		{"sam smy", []Bib{"3"}},
+		{"ZIMM", []Bib{"1"}},
+		{"zimmermen", []Bib{"1"}},
+		{"nobody", nil},
+	}
+	for _, test := range tests {
+		results := race.Snapshot().Search(test.query)
+		got := make([]Bib, len(results))
+		for x := range results {
+			got[x] = results[x].Bib
+		}
+		if len(got) != len(test.bibs) || (len(got) > 0 && !reflect.DeepEqual(got, test.bibs)) {
+			t.Errorf("Search %q - wanted %v, got %v", test.query, test.bibs, got)
+		}
+	}
+	results := race.Snapshot().Search("matthew")
+	if len(results) != 1 {
+		t.Fatalf("Expected one result, got %d", len(results))
+	}
+	if results[0].Place != 3 || results[0].GenderPlace != 2 || results[0].AgeGroupPlace != 2 {
+		t.Errorf("Wrong placements - %#v", results[0])
+	}
+	if results[0].AgeGroup != "Men's 31-35" {
+		t.Errorf("Wrong age group - %s", results[0].AgeGroup)
+	}
+	w = httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/search?q=jane", nil)
+	handler(w, r, race)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Doe") {
+		t.Errorf("Error fetching search page, got %d - %s", w.Code, w.Body.String())
+	}
+}
+
+func TestRunnerPage(t *testing.T) {
+	clock := NewManualClock(time.Now())
+	race := NewRaceWithClock(clock)
+	if err := race.AddEntry(Entry{Bib: "7", Fname: "Jane", Lname: "Doe", Age: 30}); err != nil {
+		t.Fatalf("Error adding entry - %v", err)
+	}
+	startRace(race)
+	clock.Advance(time.Minute)
+	linkBibTesting(t, race, "7", false, false)
+	linkBibTesting(t, race, "7", false, true)
+	tests := []struct {
+		url      string
+		code     int
+		contains string
+	}{
+		{"/runner/7", http.StatusOK, "00:01:00.00"},
+		{"/runner/8", http.StatusNotFound, ""},
+		{"/runner/abc", http.StatusNotFound, ""},
+		{"/results", http.StatusOK, "/runner/7/qr.png"},
+		{"/runner/7/qr.png", http.StatusOK, "PNG"},
+		{"/runner/abc/qr.png", http.StatusNotFound, ""},
+		{"/runner/7/anything", http.StatusNotFound, ""},
+		{"/runner/7/qr.png/more", http.StatusNotFound, ""},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest("GET", test.url, nil)
+		if strings.HasPrefix(test.url, "/runner/") {
+			runnerHandler(w, r, race)
+		} else {
+			handler(w, r, race)
+		}
+		if w.Code != test.code || !strings.Contains(w.Body.String(), test.contains) {
+			t.Errorf("%s - expected %d containing %q, got %d - %s", test.url, test.code, test.contains, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestBibLabels(t *testing.T) {
+	race := NewRace()
+	if !testUploadRacersHelper(t, "test_runners.csv", 301, race) {
+		t.Error()
+	}
+	tests := []struct {
+		url      string
+		code     int
+		contains []string
+	}{
+		{"/bibs", http.StatusOK, []string{`<div class="bib-number">1</div>`, `<div class="bib-number">6</div>`, "data:image/png;base64,"}},
+		{"/bibs?from=2&to=3", http.StatusOK, []string{`<div class="bib-number">2</div>`, `<div class="bib-number">3</div>`}},
+		{"/bibs?from=3&to=2", 409, nil},
+		{"/bibs/2.png", http.StatusOK, []string{"PNG"}},
+		{"/bibs/1000.png", http.StatusNotFound, nil},
+		{"/bibs/abc", http.StatusNotFound, nil},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest("GET", test.url, nil)
+		bibLabelsHandler(w, r, race)
+		if w.Code != test.code {
+			t.Errorf("%s - expected %d, got %d - %s", test.url, test.code, w.Code, w.Body.String())
+		}
+		for _, c := range test.contains {
+			if !strings.Contains(w.Body.String(), c) {
+				t.Errorf("%s - expected to contain %q", test.url, c)
+			}
+		}
+	}
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/bibs?from=2&to=3", nil)
+	bibLabelsHandler(w, r, race)
+	if strings.Contains(w.Body.String(), `<div class="bib-number">1</div>`) {
+		t.Errorf("Bib 1 should not be in the range 2-3")
+	}
+}
+
+// loadTestPrizes uploads test_prizes.json to the race
+func loadTestPrizes(tb testing.TB, race *Race) {
+	req, err := uploadFile("test_prizes.json")
+	if err != nil {
+		tb.Fatalf("Unexpected error - %v", err)
+	}
+	w := httptest.NewRecorder()
+	uploadPrizesHandler(w, req, race)
+	if w.Code != 301 {
+		tb.Fatalf("Expected redirect, got %d", w.Code)
+	}
+}
+
+func TestIncrementalOrder(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+	clock := NewManualClock(time.Now())
+	race := NewRaceWithClock(clock)
+	loadTestPrizes(t, race)
+	rnd := rand.New(rand.NewSource(42))
+	for x := 1; x <= 300; x++ {
+		if err := race.AddEntry(Entry{Bib: Bib(strconv.Itoa(x)), Fname: "Runner", Lname: strconv.Itoa(x), Age: uint(rnd.Intn(80)), Male: rnd.Intn(2) == 0}); err != nil {
+			t.Fatalf("Error adding entry - %v", err)
+		}
+	}
+	startRace(race)
+	check := func(step int) {
+		race.RLock()
+		defer race.RUnlock()
+		sorted := slices.Clone(race.allEntries)
+		sort.Stable((*EntrySort)(&sorted))
+		if !slices.Equal(sorted, race.allEntries) {
+			t.Fatalf("Step %d - entries out of order", step)
+		}
+		prizes := make([]Prize, len(race.prizes))
+		for p := range race.prizes {
+			prizes[p] = race.prizes[p]
+			prizes[p].Winners = nil
+		}
+		for _, entry := range sorted {
+			if !entry.Confirmed {
+				break
+			}
+			calculatePrizes(entry, prizes)
+		}
+		for p := range prizes {
+			if !slices.Equal(prizes[p].Winners, race.prizes[p].Winners) {
+				t.Fatalf("Step %d - %s winners differ from a full recompute", step, prizes[p].Title)
+			}
+		}
+	}
+	for step := 0; step < 2000; step++ {
+		clock.Advance(time.Millisecond * time.Duration(rnd.Intn(2000)))
+		bib := Bib(strconv.Itoa(rnd.Intn(300) + 1))
+		switch rnd.Intn(10) {
+		case 0:
+			race.RemoveTimeForBib(bib)
+		case 1, 2, 3:
+			race.ConfirmTimeForBib(bib)
+		case 4:
+			race.RLock()
+			place := Place(slices.Index(race.allEntries, race.bibbedEntries[bib]) + 1)
+			entry := *race.bibbedEntries[bib]
+			race.RUnlock()
+			entry.Duration = HumanDuration(time.Second * time.Duration(rnd.Intn(3600)))
+			race.ModifyEntry(entry.Nonce(), place, entry)
+		default:
+			race.RecordTimeForBib(bib)
+		}
+		check(step)
+	}
+}
+
+// BenchmarkFinish records and confirms finishers in a race of 20,000 with prizes, the finish line's hot path
+func BenchmarkFinish(b *testing.B) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+	const entries = 20000
+	var race *Race
+	clock := NewManualClock(time.Now())
+	for x := 0; x < b.N; x++ {
+		if x%entries == 0 {
+			b.StopTimer()
+			race = NewRaceWithClock(clock)
+			loadTestPrizes(b, race)
+			for y := 0; y < entries; y++ {
+				race.AddEntry(Entry{Bib: Bib(strconv.Itoa(y)), Fname: "Runner", Lname: strconv.Itoa(y), Age: uint(y % 80), Male: y%2 == 0})
+			}
+			race.Start(nil)
+			b.StartTimer()
+		}
+		clock.Advance(time.Millisecond * 100)
+		bib := Bib(strconv.Itoa(x % entries))
+		if err := race.RecordTimeForBib(bib); err != nil {
+			b.Fatalf("Error recording bib - %v", err)
+		}
+		if err := race.ConfirmTimeForBib(bib); err != nil {
+			b.Fatalf("Error confirming bib - %v", err)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const shutdownTimeout = time.Second * 30 // how long in flight requests and e-mails get to finish
+
+// emailQueue sends results e-mails in the background so shutdown can wait for them
+type emailQueue struct {
+	pending  sync.WaitGroup
+	ctx      context.Context
+	stop     context.CancelFunc // stops retrying the e-mails that haven't gone out
+	depth    atomic.Int64       // e-mails that haven't gone out yet
+	sent     atomic.Uint64
+	failures atomic.Uint64 // attempts that failed and were retried
+}
+
+func newEmailQueue() *emailQueue {
+	eq := &emailQueue{}
+	eq.ctx, eq.stop = context.WithCancel(context.Background())
+	return eq
+}
+
+var emails = newEmailQueue()
+
+func (eq *emailQueue) Send(e Entry, hd HumanDuration, emailIndex int) {
+	eq.pending.Add(1)
+	eq.depth.Add(1)
+	go func() {
+		defer eq.pending.Done()
+		defer eq.depth.Add(-1)
+		if sendEmailResponse(eq.ctx, e, hd, emailIndex, &eq.failures) {
+			eq.sent.Add(1)
+		}
+	}()
+}
+
+// Flush waits for pending e-mails until ctx is done, then gives up on the ones that haven't gone out
+func (eq *emailQueue) Flush(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		eq.pending.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		eq.stop()
+		<-done
+		return fmt.Errorf("Gave up on unsent e-mails - %v", ctx.Err())
+	}
+}
+
+// writeSnapshot saves the race as a CSV in dir, the same as /download, and returns the file's name
+// it's written to a temporary file first so a crash can't leave a partial snapshot behind
+func writeSnapshot(race *Race, dir string, prefix string) (string, error) {
+	filename := filepath.Join(dir, fmt.Sprintf("%s-%s.csv", prefix, race.GetTime().Format("2006-01-02T150405")))
+	tmp, err := os.CreateTemp(dir, prefix+"-*.tmp")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name()) // fails harmlessly once it's been renamed
+	writer := csv.NewWriter(tmp)
+	if err = race.WriteCSV(writer); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	writer.Flush()
+	if err = writer.Error(); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err = tmp.Sync(); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err = tmp.Close(); err != nil {
+		return "", err
+	}
+	return filename, os.Rename(tmp.Name(), filename)
+}
+
+// shutdown stops accepting requests and waits for the in flight ones, flushes the e-mails and saves a final snapshot
+func shutdown(servers []*http.Server, race *Race, eq *emailQueue) error {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	slog.Info("Shutting down, waiting for requests and e-mails to finish", "timeout", shutdownTimeout)
+	var errs []error
+	for _, srv := range servers {
+		if err := srv.Shutdown(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("Error draining requests - %v", err))
+		}
+	}
+	if err := eq.Flush(ctx); err != nil {
+		errs = append(errs, err)
+	}
+	filename, err := writeSnapshot(race, config.DataDir, "final")
+	if err != nil {
+		errs = append(errs, fmt.Errorf("Error writing final snapshot - %v", err))
+	} else {
+		slog.Info("Final results saved", "file", filename)
+	}
+	return errors.Join(errs...)
+}
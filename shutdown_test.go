@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestShutdown(t *testing.T) {
+	defer func(dataDir string) {
+		config.DataDir = dataDir
+	}(config.DataDir)
+	config.DataDir = t.TempDir()
+	clock := NewManualClock(time.Now())
+	race := NewRaceWithClock(clock)
+	if err := race.AddEntry(Entry{Bib: "7", Fname: "Jane", Lname: "Doe", Age: 30}); err != nil {
+		t.Fatalf("Error adding entry - %v", err)
+	}
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		io.WriteString(w, "finished")
+	})}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error listening - %v", err)
+	}
+	go srv.Serve(listener)
+	type result struct {
+		body string
+		err  error
+	}
+	inFlight := make(chan result)
+	go func() {
+		resp, err := http.Get("http://" + listener.Addr().String() + "/")
+		if err != nil {
+			inFlight <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		inFlight <- result{string(body), err}
+	}()
+	<-started
+
+	shutdownErr := make(chan error)
+	go func() {
+		shutdownErr <- shutdown([]*http.Server{srv}, race, newEmailQueue())
+	}()
+	select {
+	case err = <-shutdownErr:
+		t.Fatalf("Shutdown finished before the in flight request - %v", err)
+	case <-time.After(time.Millisecond * 100):
+	}
+	if _, err = net.Dial("tcp", listener.Addr().String()); err == nil {
+		t.Errorf("Expected new connections to be refused while shutting down")
+	}
+	close(release)
+	if res := <-inFlight; res.err != nil || res.body != "finished" {
+		t.Errorf("Expected the in flight request to finish, got %q %v", res.body, res.err)
+	}
+	if err = <-shutdownErr; err != nil {
+		t.Errorf("Error shutting down - %v", err)
+	}
+
+	snapshots, _ := filepath.Glob(filepath.Join(config.DataDir, "final-*.csv"))
+	if len(snapshots) != 1 {
+		t.Fatalf("Expected one final snapshot, got %v", snapshots)
+	}
+	f, err := os.Open(snapshots[0])
+	if err != nil {
+		t.Fatalf("Error opening snapshot - %v", err)
+	}
+	defer f.Close()
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil || len(records) != 2 || records[1][0] != "Jane" {
+		t.Errorf("Expected the snapshot to have the race's entries, got %v %v", records, err)
+	}
+	if leftovers, _ := filepath.Glob(filepath.Join(config.DataDir, "*.tmp")); len(leftovers) != 0 {
+		t.Errorf("Expected no temporary files left behind, got %v", leftovers)
+	}
+}
+
+func TestFlushEmails(t *testing.T) {
+	eq := newEmailQueue()
+	eq.pending.Add(1)
+	go func() {
+		time.Sleep(time.Millisecond * 50)
+		eq.pending.Done()
+	}()
+	if err := eq.Flush(context.Background()); err != nil {
+		t.Errorf("Expected pending e-mails to be waited for, got %v", err)
+	}
+
+	// an e-mail stuck retrying gives up once the timeout passes
+	eq.pending.Add(1)
+	go func() {
+		defer eq.pending.Done()
+		<-eq.ctx.Done()
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	if err := eq.Flush(ctx); err == nil || !strings.Contains(err.Error(), "unsent") {
+		t.Errorf("Expected an error giving up on e-mails, got %v", err)
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"slices"
+	"time"
+)
+
+// RaceSnapshot is a read only copy of the race at one version, pages render from it without locking the race so
+// however many results screens are refreshing, recording a finish never waits on them
+type RaceSnapshot struct {
+	Version             uint64
+	Modified            time.Time // when the race last changed, zero if it never has
+	Started             time.Time
+	Scheduled           time.Time
+	OptionalEntryFields []string
+	Entries             []*Entry       // copies of allEntries, sorted by place
+	Bibbed              map[Bib]*Entry // points into Entries
+	Audit               []Audit
+	Prizes              []Prize // Winners point into Entries
+	LastConfirmed       Bib
+	Results             []RunnerResult // the placements for Entries, in the same order
+}
+
+// Lock takes the write lock, timing how long it waited for /metrics
+func (race *Race) Lock() {
+	start := time.Now()
+	race.RWMutex.Lock()
+	race.writeWait.Observe(time.Since(start))
+}
+
+// RLock takes the read lock, timing how long it waited for /metrics
+func (race *Race) RLock() {
+	start := time.Now()
+	race.RWMutex.RLock()
+	race.readWait.Observe(time.Since(start))
+}
+
+// Unlock releases the write lock, every change to the race is made holding it so releasing it after a change is what
+// marks the current snapshot stale, taking the lock to look or for a change that failed leaves the snapshot as it is
+func (race *Race) Unlock() {
+	if race.dirty {
+		race.dirty = false
+		race.modified.Store(race.GetTime().UnixNano())
+		race.version.Add(1)
+	}
+	race.RWMutex.Unlock()
+}
+
+// changed marks the race changed for Unlock, every change made holding the lock calls it, lockedReposition for a
+// change to an entry or entriesChanged
+func (race *Race) changed() {
+	race.dirty = true
+}
+
+// entriesChanged is changed for a change to every entry, like moving the start, the next snapshot copies them all
+func (race *Race) entriesChanged() {
+	race.dirty = true
+	clear(race.entryCopies)
+}
+
+// Snapshot returns the race as of its latest change, it only copies the race the first time it's asked for after a
+// change, every other caller shares that copy, nothing in it may be modified
+func (race *Race) Snapshot() *RaceSnapshot {
+	if snap := race.snapshot.Load(); snap != nil && snap.Version == race.version.Load() {
+		return snap
+	}
+	race.snapshotLock.Lock()
+	defer race.snapshotLock.Unlock()
+	if snap := race.snapshot.Load(); snap != nil && snap.Version == race.version.Load() {
+		return snap // another request copied it while this one waited
+	}
+	race.RLock()
+	snap, placed := race.lockedSnapshot()
+	race.RUnlock()
+	snap.link(placed)
+	snap.Results = computeResults(snap.Entries, snap.Prizes)
+	race.snapshot.Store(snap)
+	return snap
+}
+
+// lockedSnapshot copies what changed in the race since the last snapshot, holding off the finish line for as short a
+// time as it can: the entries that didn't change share their copies with the last snapshot, the audit log is only
+// ever appended to so it's shared too and the rest is left to link, which doesn't need the lock, it fills in
+// entryCopies so it's only called with snapshotLock held, the version can't move while the lock is held
+func (race *Race) lockedSnapshot() (*RaceSnapshot, []*Entry) {
+	snap := &RaceSnapshot{
+		Version:             race.version.Load(),
+		Modified:            lastModified(race.modified.Load()),
+		Started:             race.started,
+		Scheduled:           race.scheduled,
+		OptionalEntryFields: slices.Clone(race.optionalEntryFields),
+		Entries:             make([]*Entry, len(race.allEntries)),
+		Audit:               slices.Clip(race.auditLog),
+		Prizes:              make([]Prize, len(race.prizes)),
+		LastConfirmed:       race.lastConfirmed,
+	}
+	if len(race.entryCopies) != len(race.allEntries) {
+		race.entryCopies = make([]*Entry, len(race.allEntries))
+	}
+	for x, entry := range race.allEntries {
+		if race.entryCopies[x] == nil {
+			e := *entry
+			e.Optional = slices.Clone(entry.Optional)
+			race.entryCopies[x] = &e
+		}
+	}
+	copy(snap.Entries, race.entryCopies)
+	for x, prize := range race.prizes {
+		snap.Prizes[x] = prize
+		snap.Prizes[x].Winners = slices.Clone(prize.Winners) // still the race's entries until link
+	}
+	return snap, slices.Clone(race.allEntries[:race.prized]) // the winners are all among the entries placed so far
+}
+
+// link fills in the bibs and points the prize winners at the snapshot's copies, placed is the front of the race's
+// entries as they were copied, they're only compared, not read, so it doesn't need the lock
+func (snap *RaceSnapshot) link(placed []*Entry) {
+	snap.Bibbed = make(map[Bib]*Entry, len(snap.Entries))
+	winners := make(map[*Entry]*Entry)
+	for _, prize := range snap.Prizes {
+		for _, winner := range prize.Winners {
+			winners[winner] = nil
+		}
+	}
+	for _, entry := range snap.Entries {
+		if entry.Bib != NoBib {
+			snap.Bibbed[entry.Bib] = entry
+		}
+	}
+	for x, entry := range placed {
+		if _, ok := winners[entry]; ok {
+			winners[entry] = snap.Entries[x]
+		}
+	}
+	for _, prize := range snap.Prizes {
+		for y, winner := range prize.Winners {
+			prize.Winners[y] = winners[winner]
+		}
+	}
+}
+
+func lastModified(unixNano int64) time.Time {
+	if unixNano == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, unixNano)
+}
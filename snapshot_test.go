@@ -0,0 +1,176 @@
+package main
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSnapshot(t *testing.T) {
+	clock := NewManualClock(time.Now())
+	race := NewRaceWithClock(clock)
+	for _, e := range []Entry{
+		{Bib: "1", Fname: "Matthew", Lname: "Zimmerman", Age: 34, Male: true},
+		{Bib: "2", Fname: "Sarah", Lname: "Smith", Age: 28},
+	} {
+		if err := race.AddEntry(e); err != nil {
+			t.Fatalf("Error adding entry - %v", err)
+		}
+	}
+	race.SetPrizes([]Prize{{Title: "Overall", HighAge: 100, Gender: "O", Amount: 1}})
+	startRace(race)
+	before := race.Snapshot()
+	if again := race.Snapshot(); again != before {
+		t.Errorf("Expected the same snapshot until the race changes")
+	}
+	clock.Advance(time.Minute)
+	if err := race.RecordTimeForBib("2"); err != nil {
+		t.Fatalf("Error recording bib - %v", err)
+	}
+	if err := race.ConfirmTimeForBib("2"); err != nil {
+		t.Fatalf("Error confirming bib - %v", err)
+	}
+	after := race.Snapshot()
+	if after.Version <= before.Version {
+		t.Errorf("Expected a newer version after recording a time, got %d then %d", before.Version, after.Version)
+	}
+	if want := clock.Now(); !after.Modified.Equal(want) {
+		t.Errorf("Expected modified from the race's clock at %s, got %s", want, after.Modified)
+	}
+	if before.Bibbed["2"].HasFinished() || len(before.Audit) != 0 {
+		t.Errorf("Expected the earlier snapshot not to change, got %s and %d audits", before.Bibbed["2"].Duration, len(before.Audit))
+	}
+	if after.Entries[0] != after.Bibbed["2"] || after.Prizes[0].Winners[0] != after.Bibbed["2"] {
+		t.Errorf("Expected the snapshot's bibs and prize winners to point at its own entries")
+	}
+	if after.Entries[0] == race.bibbedEntries["2"] {
+		t.Errorf("Expected the snapshot to have copies of the entries")
+	}
+	if result, ok := after.Runner("2"); !ok || result.Place != 1 || len(result.Prizes) != 1 {
+		t.Errorf("Expected bib 2 in first with the overall prize, got %#v", result)
+	}
+	if err := race.RecordTimeForBib("99"); err == nil {
+		t.Errorf("Expected an error recording a bib that isn't in the race")
+	}
+	if again := race.Snapshot(); again != after {
+		t.Errorf("Expected a change that failed to leave the snapshot as it was")
+	}
+	clock.Advance(time.Minute)
+	if err := race.RecordTimeForBib("1"); err != nil {
+		t.Fatalf("Error recording bib - %v", err)
+	}
+	if latest := race.Snapshot(); latest.Bibbed["2"] != after.Bibbed["2"] || latest.Bibbed["1"] == after.Bibbed["1"] {
+		t.Errorf("Expected only the changed entry to be copied again")
+	}
+
+	// a fresh snapshot renders while a change holds the race
+	race.Lock()
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/results", nil)
+	done := make(chan struct{})
+	go func() {
+		handler(w, r, race)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second * 5):
+		t.Errorf("Expected the page to render without waiting for the lock")
+	}
+	race.Unlock()
+	<-done
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected the results page, got %d - %s", w.Code, w.Body.String())
+	}
+}
+
+func TestSnapshotConcurrent(t *testing.T) {
+	clock := NewManualClock(time.Now())
+	race := NewRaceWithClock(clock)
+	for x := 1; x <= 50; x++ {
+		if err := race.AddEntry(Entry{Bib: Bib(strconv.Itoa(x)), Fname: "Runner", Lname: strconv.Itoa(x), Age: 30}); err != nil {
+			t.Fatalf("Error adding entry - %v", err)
+		}
+	}
+	startRace(race)
+	var wg sync.WaitGroup
+	for x := 0; x < 8; x++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for y := 0; y < 20; y++ {
+				w := httptest.NewRecorder()
+				r, _ := http.NewRequest("GET", "/results", nil)
+				race.GenerateTemplate(templateRequest{name: "results", writer: w, request: r})
+			}
+		}()
+	}
+	for x := 1; x <= 50; x++ {
+		if err := race.RecordTimeForBib(Bib(strconv.Itoa(x))); err != nil {
+			t.Errorf("Error recording bib - %v", err)
+		}
+	}
+	wg.Wait()
+	if snap := race.Snapshot(); len(snap.Audit) != 50 {
+		t.Errorf("Expected the latest snapshot to have every finish, got %d", len(snap.Audit))
+	}
+}
+
+// BenchmarkFinishWithSnapshots is BenchmarkFinish with spectators refreshing the results the whole time, so every
+// finish is followed by a snapshot, the finish line shouldn't slow down with the size of the race
+func BenchmarkFinishWithSnapshots(b *testing.B) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+	const entries = 20000
+	var race atomic.Pointer[Race]
+	clock := NewManualClock(time.Now())
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for x := 0; x < 4; x++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				if r := race.Load(); r != nil {
+					r.Snapshot()
+				}
+			}
+		}()
+	}
+	for x := 0; x < b.N; x++ {
+		if x%entries == 0 {
+			b.StopTimer()
+			r := NewRaceWithClock(clock)
+			loadTestPrizes(b, r)
+			for y := 0; y < entries; y++ {
+				r.AddEntry(Entry{Bib: Bib(strconv.Itoa(y)), Fname: "Runner", Lname: strconv.Itoa(y), Age: uint(y % 80), Male: y%2 == 0})
+			}
+			r.Start(nil)
+			race.Store(r)
+			b.StartTimer()
+		}
+		clock.Advance(time.Millisecond * 100)
+		bib := Bib(strconv.Itoa(x % entries))
+		if err := race.Load().RecordTimeForBib(bib); err != nil {
+			b.Fatalf("Error recording bib - %v", err)
+		}
+		if err := race.Load().ConfirmTimeForBib(bib); err != nil {
+			b.Fatalf("Error confirming bib - %v", err)
+		}
+	}
+	b.StopTimer()
+	close(done)
+	wg.Wait()
+}
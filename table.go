@@ -0,0 +1,315 @@
+package main
+
+import (
+	"cmp"
+	"math"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultPerPage = 100  // entries on one page of a table unless ?per= asks for more
+	maxPerPage     = 1000 // so even ?per= can't ask for every entry of a big race at once
+)
+
+// TableQuery is how a page's entry table is sorted, filtered and paged, it all comes from the URL so a view can be
+// bookmarked and survives the public page refreshing itself
+type TableQuery struct {
+	Path    string
+	Sort    string // place, bib, name, age, gender or one of the optional fields
+	Desc    bool
+	Show    string // finished, unfinished, unconfirmed or blank for everyone
+	Gender  string // M, F or blank for both
+	Age     string // an age group, 20-29, 60- or -14
+	Q       string // matched against the bib, names and optional fields
+	Page    int    // from 1
+	PerPage int
+	lowAge  uint
+	highAge uint
+}
+
+// parseTableQuery reads the table's parameters, anything it doesn't understand is left at the default rather than
+// showing spectators an error
+func parseTableQuery(r *http.Request) TableQuery {
+	q := TableQuery{
+		Path:    r.URL.Path,
+		Sort:    cmp.Or(strings.TrimSpace(r.FormValue("sort")), "place"),
+		Desc:    r.FormValue("desc") == "true",
+		Show:    r.FormValue("show"),
+		Gender:  strings.ToUpper(r.FormValue("gender")),
+		Q:       strings.TrimSpace(r.FormValue("q")),
+		Page:    1,
+		PerPage: defaultPerPage,
+	}
+	switch q.Show {
+	case "finished", "unfinished", "unconfirmed":
+	default:
+		q.Show = ""
+	}
+	if q.Gender != "M" && q.Gender != "F" {
+		q.Gender = ""
+	}
+	if low, high, ok := parseAgeGroup(r.FormValue("age")); ok {
+		q.Age, q.lowAge, q.highAge = strings.TrimSpace(r.FormValue("age")), low, high
+	}
+	if page, err := strconv.Atoi(r.FormValue("page")); err == nil && page > 1 {
+		q.Page = page
+	}
+	if per, err := strconv.Atoi(r.FormValue("per")); err == nil && per > 0 {
+		q.PerPage = min(per, maxPerPage)
+	}
+	return q
+}
+
+// parseAgeGroup reads 20-29, 60- (and over), -14 (and under) or a single age
+func parseAgeGroup(val string) (low, high uint, ok bool) {
+	val = strings.TrimSpace(val)
+	if val == "" {
+		return 0, 0, false
+	}
+	lowVal, highVal, isRange := strings.Cut(val, "-")
+	if !isRange {
+		highVal = lowVal
+	}
+	high = math.MaxUint32
+	if lowVal != "" {
+		age, err := strconv.ParseUint(strings.TrimSpace(lowVal), 10, 32)
+		if err != nil {
+			return 0, 0, false
+		}
+		low = uint(age)
+	}
+	if highVal != "" {
+		age, err := strconv.ParseUint(strings.TrimSpace(highVal), 10, 32)
+		if err != nil {
+			return 0, 0, false
+		}
+		high = uint(age)
+	}
+	return low, high, low <= high
+}
+
+// Filtered is true when the table isn't showing every entry
+func (q TableQuery) Filtered() bool {
+	return q.Show != "" || q.Gender != "" || q.Age != "" || q.Q != ""
+}
+
+func (q TableQuery) values() url.Values {
+	v := url.Values{}
+	if q.Sort != "place" {
+		v.Set("sort", q.Sort)
+	}
+	for key, val := range map[string]string{"show": q.Show, "gender": q.Gender, "age": q.Age, "q": q.Q} {
+		if val != "" {
+			v.Set(key, val)
+		}
+	}
+	if q.Desc {
+		v.Set("desc", "true")
+	}
+	if q.Page > 1 {
+		v.Set("page", strconv.Itoa(q.Page))
+	}
+	if q.PerPage != defaultPerPage {
+		v.Set("per", strconv.Itoa(q.PerPage))
+	}
+	return v
+}
+
+func (q TableQuery) url() string {
+	if v := q.values(); len(v) > 0 {
+		return q.Path + "?" + v.Encode()
+	}
+	return q.Path
+}
+
+// SortURL is the link for a column heading, it sorts by the column or reverses it if it's already sorted by it
+func (q TableQuery) SortURL(column string) string {
+	q.Desc = q.Sort == column && !q.Desc
+	q.Sort, q.Page = column, 1
+	return q.url()
+}
+
+// SortMark shows which way the table is sorted next to the column's heading
+func (q TableQuery) SortMark(column string) string {
+	switch {
+	case q.Sort != column:
+		return ""
+	case q.Desc:
+		return " ▼"
+	default:
+		return " ▲"
+	}
+}
+
+// PageURL links to another page of the same view
+func (q TableQuery) PageURL(page int) string {
+	q.Page = page
+	return q.url()
+}
+
+// EntryRow is an entry in a table with its place in the race, which sorting and filtering the table doesn't change
+type EntryRow struct {
+	*Entry
+	Place Place
+}
+
+// EntryTable is one page of entries as a TableQuery asked for them
+type EntryTable struct {
+	TableQuery
+	Rows  []EntryRow
+	Total int // entries matching the filters, on every page
+	Pages int
+}
+
+// First and Last number the rows on this page for "Showing 101-200 of 523"
+func (t EntryTable) First() int {
+	if len(t.Rows) == 0 {
+		return 0
+	}
+	return (t.Page-1)*t.PerPage + 1
+}
+
+func (t EntryTable) Last() int {
+	return (t.Page-1)*t.PerPage + len(t.Rows)
+}
+
+func (t EntryTable) PrevURL() string {
+	if t.Page <= 1 {
+		return ""
+	}
+	return t.PageURL(t.Page - 1)
+}
+
+func (t EntryTable) NextURL() string {
+	if t.Page >= t.Pages {
+		return ""
+	}
+	return t.PageURL(t.Page + 1)
+}
+
+// Table filters, sorts and pages the snapshot's entries, every view of the race works from it so a page is never
+// bigger than PerPage entries however many are in the race
+func (s *RaceSnapshot) Table(q TableQuery) EntryTable {
+	field := slices.Index(s.OptionalEntryFields, q.Sort)
+	switch q.Sort {
+	case "place", "bib", "name", "age", "gender":
+	default:
+		if field < 0 {
+			q.Sort = "place"
+		}
+	}
+	rows := make([]EntryRow, 0, len(s.Entries))
+	terms := strings.Fields(strings.ToLower(q.Q))
+	for x, entry := range s.Entries {
+		if q.matches(entry, terms) {
+			rows = append(rows, EntryRow{Entry: entry, Place: Place(x + 1)})
+		}
+	}
+	if compare := rowComparison(q.Sort, field); compare == nil {
+		if q.Desc {
+			slices.Reverse(rows)
+		}
+	} else if q.Desc {
+		slices.SortStableFunc(rows, func(a, b EntryRow) int {
+			return compare(b, a)
+		})
+	} else {
+		slices.SortStableFunc(rows, compare)
+	}
+	table := EntryTable{TableQuery: q, Total: len(rows), Pages: max((len(rows)+q.PerPage-1)/q.PerPage, 1)}
+	table.Page = min(q.Page, table.Pages)
+	low := (table.Page - 1) * q.PerPage
+	table.Rows = rows[low:min(low+q.PerPage, len(rows))]
+	return table
+}
+
+func (q TableQuery) matches(entry *Entry, terms []string) bool {
+	switch q.Show {
+	case "finished":
+		if !entry.HasFinished() {
+			return false
+		}
+	case "unfinished":
+		if entry.HasFinished() {
+			return false
+		}
+	case "unconfirmed":
+		if !entry.HasFinished() || entry.Confirmed {
+			return false
+		}
+	}
+	if (q.Gender == "M" && !entry.Male) || (q.Gender == "F" && entry.Male) {
+		return false
+	}
+	if q.Age != "" && (entry.Age < q.lowAge || entry.Age > q.highAge) {
+		return false
+	}
+	for _, term := range terms {
+		if !entryContains(entry, term) {
+			return false
+		}
+	}
+	return true
+}
+
+// entryContains looks for a lower case term in the entry's bib, names and optional fields
+func entryContains(entry *Entry, term string) bool {
+	if strings.Contains(strings.ToLower(string(entry.Bib)), term) ||
+		strings.Contains(strings.ToLower(entry.Fname), term) ||
+		strings.Contains(strings.ToLower(entry.Lname), term) {
+		return true
+	}
+	for _, val := range entry.Optional {
+		if strings.Contains(strings.ToLower(val), term) {
+			return true
+		}
+	}
+	return false
+}
+
+// rowComparison orders rows by a column, ties stay in place order, nil means by place
+func rowComparison(column string, field int) func(a, b EntryRow) int {
+	switch column {
+	case "place":
+		return nil // the order Entries are already in
+	case "bib":
+		return func(a, b EntryRow) int {
+			return a.Bib.Compare(b.Bib)
+		}
+	case "name":
+		return func(a, b EntryRow) int {
+			return cmp.Or(
+				cmp.Compare(strings.ToLower(a.Lname), strings.ToLower(b.Lname)),
+				cmp.Compare(strings.ToLower(a.Fname), strings.ToLower(b.Fname)),
+			)
+		}
+	case "age":
+		return func(a, b EntryRow) int {
+			return cmp.Compare(a.Age, b.Age)
+		}
+	case "gender":
+		return func(a, b EntryRow) int {
+			switch {
+			case a.Male == b.Male:
+				return 0
+			case a.Male:
+				return 1 // F before M, the way the column reads
+			}
+			return -1
+		}
+	}
+	return func(a, b EntryRow) int {
+		return cmp.Compare(strings.ToLower(optionalField(a.Entry, field)), strings.ToLower(optionalField(b.Entry, field)))
+	}
+}
+
+func optionalField(entry *Entry, field int) string {
+	if field < len(entry.Optional) {
+		return entry.Optional[field]
+	}
+	return ""
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseAgeGroup(t *testing.T) {
+	tests := []struct {
+		val       string
+		low, high uint
+		ok        bool
+	}{
+		{"20-29", 20, 29, true},
+		{" 60- ", 60, 1<<32 - 1, true},
+		{"-14", 0, 14, true},
+		{"35", 35, 35, true},
+		{"", 0, 0, false},
+		{"29-20", 0, 0, false},
+		{"twenties", 0, 0, false},
+	}
+	for _, test := range tests {
+		low, high, ok := parseAgeGroup(test.val)
+		if ok != test.ok || (ok && (low != test.low || high != test.high)) {
+			t.Errorf("%q - expected %d-%d %t, got %d-%d %t", test.val, test.low, test.high, test.ok, low, high, ok)
+		}
+	}
+}
+
+func TestTable(t *testing.T) {
+	clock := NewManualClock(time.Now())
+	race := NewRaceWithClock(clock)
+	race.optionalEntryFields = []string{"Shirt"}
+	for _, e := range []Entry{
+		{Bib: "1", Fname: "Matthew", Lname: "Zimmerman", Age: 34, Male: true, Optional: []string{"L"}},
+		{Bib: "2", Fname: "Sarah", Lname: "Smith", Age: 28, Optional: []string{"S"}},
+		{Bib: "3", Fname: "Adam", Lname: "Anderson", Age: 61, Male: true, Optional: []string{"XL"}},
+		{Bib: "10", Fname: "Beth", Lname: "smith", Age: 12, Optional: []string{"M"}},
+	} {
+		if err := race.AddEntry(e); err != nil {
+			t.Fatalf("Error adding entry - %v", err)
+		}
+	}
+	startRace(race)
+	for _, bib := range []Bib{"3", "2"} {
+		clock.Advance(time.Minute)
+		if err := race.RecordTimeForBib(bib); err != nil {
+			t.Fatalf("Error recording bib - %v", err)
+		}
+	}
+	if err := race.ConfirmTimeForBib("3"); err != nil {
+		t.Fatalf("Error confirming bib - %v", err)
+	}
+	snap := race.Snapshot()
+	tests := []struct {
+		url   string
+		bibs  string
+		total int
+		pages int
+	}{
+		{"/admin", "3 2 1 10", 4, 1},
+		{"/admin?sort=bib", "1 2 3 10", 4, 1},
+		{"/admin?sort=bib&desc=true", "10 3 2 1", 4, 1},
+		{"/admin?sort=name", "3 10 2 1", 4, 1}, // smith and Smith tie, so by first name
+		{"/admin?sort=age", "10 2 1 3", 4, 1},
+		{"/admin?sort=gender", "2 10 3 1", 4, 1},
+		{"/admin?sort=Shirt", "1 10 2 3", 4, 1},
+		{"/admin?sort=bogus", "3 2 1 10", 4, 1},
+		{"/admin?show=finished", "3 2", 2, 1},
+		{"/admin?show=unfinished", "1 10", 2, 1},
+		{"/admin?show=unconfirmed", "2", 1, 1},
+		{"/admin?gender=f", "2 10", 2, 1},
+		{"/admin?age=20-39", "2 1", 2, 1},
+		{"/admin?age=60-", "3", 1, 1},
+		{"/admin?q=smith", "2 10", 2, 1},
+		{"/admin?q=xl", "3", 1, 1},
+		{"/admin?q=beth+smith", "10", 1, 1},
+		{"/admin?q=nobody", "", 0, 1},
+		{"/admin?per=3", "3 2 1", 4, 2},
+		{"/admin?per=3&page=2", "10", 4, 2},
+		{"/admin?per=3&page=9", "10", 4, 2},
+		{"/admin?sort=bib&per=2&page=2", "3 10", 4, 2},
+	}
+	for _, test := range tests {
+		r, _ := http.NewRequest("GET", test.url, nil)
+		table := snap.Table(parseTableQuery(r))
+		bibs := make([]string, len(table.Rows))
+		for x, row := range table.Rows {
+			bibs[x] = string(row.Bib)
+			if snap.Entries[row.Place-1] != row.Entry {
+				t.Errorf("%s - expected bib %s's place to be where it is in the race, got %d", test.url, row.Bib, row.Place)
+			}
+		}
+		if got := strings.Join(bibs, " "); got != test.bibs || table.Total != test.total || table.Pages != test.pages {
+			t.Errorf("%s - expected %q of %d on %d pages, got %q of %d on %d", test.url, test.bibs, test.total, test.pages, got, table.Total, table.Pages)
+		}
+	}
+
+	r, _ := http.NewRequest("GET", "/audit?sort=age&gender=M&per=1&page=2", nil)
+	table := snap.Table(parseTableQuery(r))
+	if got, want := table.SortURL("age"), "/audit?desc=true&gender=M&per=1&sort=age"; got != want {
+		t.Errorf("Expected the age heading to reverse the sort, got %s", got)
+	}
+	if got, want := table.SortURL("bib"), "/audit?gender=M&per=1&sort=bib"; got != want {
+		t.Errorf("Expected the bib heading to sort by bib from the first page, got %s", got)
+	}
+	if table.PrevURL() != "/audit?gender=M&per=1&sort=age" || table.NextURL() != "" || table.First() != 2 || table.Last() != 2 {
+		t.Errorf("Expected the last of 2 pages, got %q %q %d-%d", table.PrevURL(), table.NextURL(), table.First(), table.Last())
+	}
+
+	// the pages only render the rows they asked for
+	for _, u := range []string{"/?q=smith", "/admin?q=smith", "/audit?q=smith"} {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest("GET", u, nil)
+		if err := race.GenerateTemplate(templateRequest{name: strings.Trim(strings.SplitN(u, "?", 2)[0], "/"), writer: w, request: r}); err != nil {
+			t.Fatalf("%s - error generating the page - %v", u, err)
+		}
+		body := w.Body.String()
+		if !strings.Contains(body, "Sarah") || strings.Contains(body, "Zimmerman") || !strings.Contains(body, "1-2 of 2") {
+			t.Errorf("%s - expected only the Smiths, got %s", u, body)
+		}
+	}
+}
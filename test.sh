@@ -5,7 +5,13 @@ export RACERGOHOSTNAME="campuslife5k"
 export RACERGORACENAME="2014 Campus Life 5k Orchard Run"
 export RACERGOEMAILFIELD="Emailcurrentlydisabled"
 export RACERGOFROMEMAIL="yfc@yfcmc.org"
+#export RACERGOADMINTOKEN="adminsecret" # a random token is generated and logged on startup if not set
+#export RACERGOTIMERTOKEN="timersecret"
+#export RACERGOREGISTRATIONTOKEN="registrationsecret"
+
+# settings can also go in a config file, see racergo -h, flags override the file which overrides the environment
+#CONFIG="-config racergo.json"
 
 # build the latest code
 # run under sudo so we can listen to port 80, this could be addressed other ways, but this is easiest
-go build -race && sudo -E ./racergo
+go build -race && sudo -E ./racergo config check $CONFIG && sudo -E ./racergo $CONFIG
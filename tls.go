@@ -0,0 +1,219 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// files generated in the data directory when no certificate is configured
+const (
+	caCertName = "racergo-ca.crt"
+	caKeyName  = "racergo-ca.key"
+	certName   = "racergo.crt"
+	keyName    = "racergo.key"
+)
+
+// httpsServing is only set while the https server is up, so http isn't redirected to a server that isn't there
+var httpsServing atomic.Bool
+
+const caLifetime = time.Hour * 24 * 365 * 10
+const certLifetime = time.Hour * 24 * 397 // the longest browsers accept for a server certificate
+const certRenewBefore = time.Hour * 24 * 30
+
+// certHosts are the names and addresses the generated certificate needs to cover
+func certHosts() ([]string, []net.IP) {
+	var names []string
+	for _, h := range config.HostNames() {
+		if h != "localhost" {
+			names = append(names, h)
+		}
+	}
+	return append(names, "localhost"), lanIPs()
+}
+
+// lanIPs are the addresses phones on the race network can reach this server at
+func lanIPs() []net.IP {
+	ips := []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback}
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		slog.Warn("Error listing network addresses", "err", err)
+		return ips
+	}
+	for _, addr := range addrs {
+		ipnet, ok := addr.(*net.IPNet)
+		if !ok || ipnet.IP.IsLoopback() || ipnet.IP.IsLinkLocalUnicast() {
+			continue
+		}
+		ips = append(ips, ipnet.IP)
+	}
+	return ips
+}
+
+// ensureCertificate returns the certificate and key files for https, creating a local CA and a certificate signed by it
+// in dir on first run, the CA is kept so phones that trusted it once keep trusting the server
+func ensureCertificate(dir string, names []string, ips []net.IP) (string, string, error) {
+	certFile, keyFile := filepath.Join(dir, certName), filepath.Join(dir, keyName)
+	ca, caKey, err := loadOrCreateCA(filepath.Join(dir, caCertName), filepath.Join(dir, caKeyName))
+	if err != nil {
+		return "", "", err
+	}
+	if certCovers(certFile, keyFile, ca, names, ips) {
+		return certFile, keyFile, nil
+	}
+	slog.Info("Generating a certificate", "names", names, "ips", ips)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+	template, err := certTemplate(certLifetime)
+	if err != nil {
+		return "", "", err
+	}
+	template.Subject = pkix.Name{CommonName: names[0]}
+	template.DNSNames = names
+	template.IPAddresses = ips
+	template.KeyUsage = x509.KeyUsageDigitalSignature
+	template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+	if err != nil {
+		return "", "", err
+	}
+	if err = writePEM(keyFile, key); err != nil {
+		return "", "", err
+	}
+	if err = os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		return "", "", err
+	}
+	return certFile, keyFile, nil
+}
+
+func loadOrCreateCA(certFile, keyFile string) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err == nil {
+		key, ok := pair.PrivateKey.(*ecdsa.PrivateKey)
+		if !ok {
+			return nil, nil, fmt.Errorf("CA key %s is not an ECDSA key", keyFile)
+		}
+		ca, err := x509.ParseCertificate(pair.Certificate[0])
+		return ca, key, err
+	}
+	if !os.IsNotExist(err) {
+		return nil, nil, fmt.Errorf("Error loading CA %s - %v", certFile, err)
+	}
+	slog.Info("Generating a local certificate authority", "file", certFile)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	template, err := certTemplate(caLifetime)
+	if err != nil {
+		return nil, nil, err
+	}
+	template.Subject = pkix.Name{CommonName: "racergo local CA", Organization: []string{config.RaceName}}
+	template.IsCA = true
+	template.BasicConstraintsValid = true
+	template.MaxPathLenZero = true
+	template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = writePEM(keyFile, key); err != nil {
+		return nil, nil, err
+	}
+	if err = os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		return nil, nil, err
+	}
+	ca, err := x509.ParseCertificate(der)
+	return ca, key, err
+}
+
+func certTemplate(lifetime time.Duration) (*x509.Certificate, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	return &x509.Certificate{
+		SerialNumber: serial,
+		NotBefore:    now.Add(-time.Hour), // allow for phones with their clocks a little off
+		NotAfter:     now.Add(lifetime),
+	}, nil
+}
+
+func writePEM(filename string, key *ecdsa.PrivateKey) error {
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0600)
+}
+
+// certCovers reports whether the existing certificate was signed by ca, isn't about to expire and covers every name and ip
+func certCovers(certFile, keyFile string, ca *x509.Certificate, names []string, ips []net.IP) bool {
+	pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return false
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil || cert.CheckSignatureFrom(ca) != nil || time.Now().Add(certRenewBefore).After(cert.NotAfter) {
+		return false
+	}
+	for _, name := range names {
+		if cert.VerifyHostname(name) != nil {
+			return false
+		}
+	}
+	for _, ip := range ips {
+		if cert.VerifyHostname(ip.String()) != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// caHandler lets volunteers download and install the local CA so their phones trust the https server
+func caHandler(w http.ResponseWriter, r *http.Request) {
+	ca, err := os.ReadFile(filepath.Join(config.DataDir, caCertName))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-x509-ca-cert")
+	w.Header().Set("Content-Disposition", "attachment; filename=\""+caCertName+"\"")
+	w.Write(ca)
+}
+
+// redirectHTTPS sends plain http requests to the https server, except for the CA which phones need before they trust it
+// and connectivity checks, which are always made over http
+func redirectHTTPS(httpsAddr string, h http.Handler) http.Handler {
+	_, port, _ := net.SplitHostPort(httpsAddr)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS != nil || r.URL.Path == "/ca.crt" || isCaptiveProbe(r) || !httpsServing.Load() {
+			h.ServeHTTP(w, r)
+			return
+		}
+		host := r.Host
+		if hostOnly, _, err := net.SplitHostPort(host); err == nil {
+			host = hostOnly
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusFound)
+	})
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEnsureCertificate(t *testing.T) {
+	dir := t.TempDir()
+	ips := []net.IP{net.IPv4(192, 168, 1, 10)}
+	certFile, keyFile, err := ensureCertificate(dir, []string{"raceresults", "localhost"}, ips)
+	if err != nil {
+		t.Fatalf("Error generating certificate - %v", err)
+	}
+	caPEM, err := os.ReadFile(filepath.Join(dir, caCertName))
+	if err != nil {
+		t.Fatalf("Expected a CA to be generated - %v", err)
+	}
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(caPEM)
+	verify := func(name string) {
+		pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			t.Fatalf("Error loading certificate - %v", err)
+		}
+		cert, err := x509.ParseCertificate(pair.Certificate[0])
+		if err != nil {
+			t.Fatalf("Error parsing certificate - %v", err)
+		}
+		if _, err = cert.Verify(x509.VerifyOptions{DNSName: name, Roots: roots}); err != nil {
+			t.Errorf("Certificate doesn't verify for %s - %v", name, err)
+		}
+	}
+	verify("raceresults")
+	verify("192.168.1.10")
+
+	before, _ := os.ReadFile(certFile)
+	if _, _, err = ensureCertificate(dir, []string{"raceresults", "localhost"}, ips); err != nil {
+		t.Fatalf("Error reloading certificate - %v", err)
+	}
+	after, _ := os.ReadFile(certFile)
+	if string(before) != string(after) {
+		t.Errorf("Expected the existing certificate to be reused")
+	}
+
+	// a new hostname needs a new certificate from the same CA so phones keep trusting it
+	if _, _, err = ensureCertificate(dir, []string{"results.local", "localhost"}, ips); err != nil {
+		t.Fatalf("Error regenerating certificate - %v", err)
+	}
+	if caAfter, _ := os.ReadFile(filepath.Join(dir, caCertName)); string(caAfter) != string(caPEM) {
+		t.Errorf("Expected the CA to be kept")
+	}
+	verify("results.local")
+}
+
+func TestRedirectHTTPS(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	h := redirectHTTPS(":8443", ok)
+	httpsServing.Store(true)
+	defer httpsServing.Store(false)
+	for url, location := range map[string]string{
+		"http://raceresults:8080/admin?x=1": "https://raceresults:8443/admin?x=1",
+		"http://raceresults/":               "https://raceresults:8443/",
+		"http://raceresults/ca.crt":         "",
+	} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+		if location == "" {
+			if w.Code != http.StatusTeapot {
+				t.Errorf("Expected %s to be served over http, got %d", url, w.Code)
+			}
+			continue
+		}
+		if got := w.Header().Get("Location"); w.Code != http.StatusFound || got != location {
+			t.Errorf("Expected %s to redirect to %s, got %d %s", url, location, w.Code, got)
+		}
+	}
+	w := httptest.NewRecorder()
+	redirectHTTPS(":443", ok).ServeHTTP(w, httptest.NewRequest("GET", "http://raceresults:8080/", nil))
+	if got := w.Header().Get("Location"); got != "https://raceresults/" {
+		t.Errorf("Expected no port on the redirect to 443, got %s", got)
+	}
+	httpsServing.Store(false)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "http://raceresults/", nil))
+	if w.Code != http.StatusTeapot {
+		t.Errorf("Expected no redirect while https is down, got %d", w.Code)
+	}
+}